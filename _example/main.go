@@ -3,6 +3,7 @@ package main
 import (
 	"log"
 	"net/http"
+	"os"
 	"path/filepath"
 
 	casper "github.com/tcnksm/go-casper"
@@ -17,8 +18,25 @@ func main() {
 	certFile, _ := filepath.Abs("crts/server.crt")
 	keyFile, _ := filepath.Abs("crts/server.key")
 
-	// Initialize casper.
-	pusher := casper.New(1<<6, 10)
+	// Load static assets.
+	catalog, err := casper.NewCatalog(os.DirFS("./static"), "/static/")
+	if err != nil {
+		log.Fatalf("[ERROR] Failed to load static assets: %s", err)
+	}
+
+	// Initialize casper. Changed assets are pushed again.
+	pusher, err := casper.NewWithConfig(&casper.Config{
+		P:       1 << 6,
+		N:       10,
+		Catalog: catalog,
+	})
+	if err != nil {
+		log.Fatalf("[ERROR] Failed to initialize casper: %s", err)
+	}
+
+	// Serve static assets. Fetched assets are recorded
+	// in the fingerprint.
+	assetServer := casper.NewAssetServer(catalog, pusher)
 
 	// Handle root
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -29,7 +47,7 @@ func main() {
 		}
 
 		// Server push!
-		if _, err := pusher.Push(w, r, assets, nil); err != nil {
+		if _, err := assetServer.Push(w, r, assets, nil); err != nil {
 			log.Fatalf("[ERROR] Failed to push assets %v: %s", assets, err)
 		}
 
@@ -45,7 +63,7 @@ func main() {
 	// Handle static assets.
 	http.HandleFunc("/static/", func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("[INFO] %s %s", r.Method, r.URL.String())
-		http.StripPrefix("/static/", http.FileServer(http.Dir("./static"))).ServeHTTP(w, r)
+		assetServer.ServeHTTP(w, r)
 	})
 
 	// Start listening.
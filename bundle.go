@@ -0,0 +1,370 @@
+package casper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Manifest maps entry points of the front-end build to the assets
+// which are needed to render them. It's generated from a bundler
+// manifest so that handlers don't need to know the hashed file names.
+type Manifest struct {
+	entries map[string][]string
+
+	// sizes are the sizes of the assets in bytes
+	// if the manifest has them.
+	sizes map[string]int64
+}
+
+// ManifestOptions includes options for loading bundler manifests.
+type ManifestOptions struct {
+	// PublicPath is the URL path prefix of the output files
+	// (e.g., "/static/"). It's not added to the files which are
+	// already absolute. If empty, "/" is used.
+	PublicPath string
+
+	// OutDir is the output directory of the bundler. It's removed
+	// from the output file paths in esbuild metafile.
+	OutDir string
+}
+
+// EntryAssets returns the assets of the given entry point including
+// its static imports. The entry file comes first.
+func (m *Manifest) EntryAssets(entry string) ([]string, error) {
+	assets, ok := m.entries[entry]
+	if !ok {
+		return nil, fmt.Errorf("unknown entry %q", entry)
+	}
+	return assets, nil
+}
+
+// Size returns the size of the asset in bytes. Only esbuild metafile
+// has the sizes of the output files.
+func (m *Manifest) Size(asset string) (int64, bool) {
+	size, ok := m.sizes[asset]
+	return size, ok
+}
+
+// Entries returns the names of all entry points sorted by the name.
+func (m *Manifest) Entries() []string {
+	entries := make([]string, 0, len(m.entries))
+	for entry := range m.entries {
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+	return entries
+}
+
+// LoadWebpackManifest loads the manifest generated by
+// webpack-manifest-plugin.
+//
+// The default output of the plugin maps the file names (e.g., "main.js")
+// to the output files. Files with the same name without the extension
+// are grouped as one entry point ("main"). Source maps are ignored.
+// If the manifest has "entrypoints" (generated with the "generate"
+// option), it's used instead.
+//
+//	{
+//	  "entrypoints": {
+//	    "main": ["main.3f2a.js", "main.9b1c.css"]
+//	  }
+//	}
+func LoadWebpackManifest(r io.Reader, opts *ManifestOptions) (*Manifest, error) {
+	if opts == nil {
+		opts = &ManifestOptions{}
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("failed to decode webpack manifest: %s", err)
+	}
+
+	m := &Manifest{entries: make(map[string][]string)}
+	if data, ok := raw["entrypoints"]; ok {
+		var entrypoints map[string][]string
+		if err := json.Unmarshal(data, &entrypoints); err != nil {
+			return nil, fmt.Errorf("failed to decode webpack entrypoints: %s", err)
+		}
+
+		for entry, files := range entrypoints {
+			for _, file := range files {
+				m.add(entry, publicURL(opts.PublicPath, file))
+			}
+		}
+		return m, nil
+	}
+
+	names := make([]string, 0, len(raw))
+	for name := range raw {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if path.Ext(name) == ".map" {
+			continue
+		}
+
+		var file string
+		if err := json.Unmarshal(raw[name], &file); err != nil {
+			return nil, fmt.Errorf("invalid webpack manifest entry %q: %s", name, err)
+		}
+
+		entry := strings.TrimSuffix(name, path.Ext(name))
+		m.add(entry, publicURL(opts.PublicPath, file))
+	}
+	return m, nil
+}
+
+// viteChunk is a chunk in Vite manifest.
+type viteChunk struct {
+	File    string   `json:"file"`
+	Name    string   `json:"name"`
+	Src     string   `json:"src"`
+	IsEntry bool     `json:"isEntry"`
+	Imports []string `json:"imports"`
+	CSS     []string `json:"css"`
+	Assets  []string `json:"assets"`
+}
+
+// LoadViteManifest loads the manifest generated by Vite (build.manifest).
+//
+// Each chunk with "isEntry" is an entry point. It's named by the chunk
+// name, and is also accessible by its source path (e.g., "src/main.ts").
+// The chunk name shared by multiple entry points (e.g., "index" of
+// "src/a/index.html" and "src/b/index.html") is ambiguous, so only
+// their source paths are available.
+// The assets include the CSS and the static imports of the entry
+// transitively. Dynamic imports are not included since they may not
+// be needed.
+func LoadViteManifest(r io.Reader, opts *ManifestOptions) (*Manifest, error) {
+	if opts == nil {
+		opts = &ManifestOptions{}
+	}
+
+	var chunks map[string]*viteChunk
+	if err := json.NewDecoder(r).Decode(&chunks); err != nil {
+		return nil, fmt.Errorf("failed to decode vite manifest: %s", err)
+	}
+
+	m := &Manifest{entries: make(map[string][]string)}
+	aliases := make(entryAliases)
+	for key, chunk := range chunks {
+		if !chunk.IsEntry {
+			continue
+		}
+
+		var files []string
+		if err := walkViteChunk(chunks, key, make(map[string]bool), &files); err != nil {
+			return nil, err
+		}
+
+		urls := make([]string, 0, len(files))
+		for _, file := range files {
+			urls = append(urls, publicURL(opts.PublicPath, file))
+		}
+
+		names := []string{key}
+		if chunk.Src != "" && chunk.Src != key {
+			names = append(names, chunk.Src)
+		}
+		for _, name := range names {
+			for _, u := range urls {
+				m.add(name, u)
+			}
+		}
+
+		alias := chunk.Name
+		if alias == "" {
+			alias = strings.TrimSuffix(path.Base(key), path.Ext(key))
+		}
+		aliases.add(alias, key, urls)
+	}
+
+	aliases.addTo(m)
+	return m, nil
+}
+
+// walkViteChunk appends the files of the chunk and its static imports
+// to files in depth-first order.
+func walkViteChunk(chunks map[string]*viteChunk, key string, visited map[string]bool, files *[]string) error {
+	if visited[key] {
+		return nil
+	}
+	visited[key] = true
+
+	chunk, ok := chunks[key]
+	if !ok {
+		return fmt.Errorf("vite manifest: unknown chunk %q", key)
+	}
+
+	*files = append(*files, chunk.File)
+	*files = append(*files, chunk.CSS...)
+	for _, imp := range chunk.Imports {
+		if err := walkViteChunk(chunks, imp, visited, files); err != nil {
+			return err
+		}
+	}
+	*files = append(*files, chunk.Assets...)
+	return nil
+}
+
+// esbuildMetafile is the metafile generated by esbuild.
+type esbuildMetafile struct {
+	Outputs map[string]*esbuildOutput `json:"outputs"`
+}
+
+type esbuildOutput struct {
+	EntryPoint string `json:"entryPoint"`
+	CSSBundle  string `json:"cssBundle"`
+	Bytes      int64  `json:"bytes"`
+	Imports    []struct {
+		Path     string `json:"path"`
+		Kind     string `json:"kind"`
+		External bool   `json:"external"`
+	} `json:"imports"`
+}
+
+// LoadEsbuildMetafile loads the metafile generated by esbuild
+// (the "metafile" option).
+//
+// Each output with "entryPoint" is an entry point. It's named by
+// the base name of the entry point without the extension (e.g.,
+// "main" for "src/main.ts") and is also accessible by the entry point
+// path. The base name shared by multiple entry points is ambiguous, so
+// only their entry point paths are available. The assets include the
+// CSS bundle and the static imports of the entry transitively.
+func LoadEsbuildMetafile(r io.Reader, opts *ManifestOptions) (*Manifest, error) {
+	if opts == nil {
+		opts = &ManifestOptions{}
+	}
+
+	var meta esbuildMetafile
+	if err := json.NewDecoder(r).Decode(&meta); err != nil {
+		return nil, fmt.Errorf("failed to decode esbuild metafile: %s", err)
+	}
+
+	outDir := path.Clean(opts.OutDir) + "/"
+	url := func(file string) string {
+		return publicURL(opts.PublicPath, strings.TrimPrefix(path.Clean(file), outDir))
+	}
+
+	m := &Manifest{
+		entries: make(map[string][]string),
+		sizes:   make(map[string]int64),
+	}
+	aliases := make(entryAliases)
+	for key, output := range meta.Outputs {
+		m.sizes[url(key)] = output.Bytes
+
+		if output.EntryPoint == "" {
+			continue
+		}
+
+		var files []string
+		if err := walkEsbuildOutput(meta.Outputs, key, make(map[string]bool), &files); err != nil {
+			return nil, err
+		}
+
+		urls := make([]string, 0, len(files))
+		for _, file := range files {
+			urls = append(urls, url(file))
+			m.add(output.EntryPoint, url(file))
+		}
+
+		base := path.Base(output.EntryPoint)
+		aliases.add(strings.TrimSuffix(base, path.Ext(base)), output.EntryPoint, urls)
+	}
+
+	aliases.addTo(m)
+	return m, nil
+}
+
+// walkEsbuildOutput appends the files of the output and its static
+// imports to files in depth-first order.
+func walkEsbuildOutput(outputs map[string]*esbuildOutput, key string, visited map[string]bool, files *[]string) error {
+	if visited[key] {
+		return nil
+	}
+	visited[key] = true
+
+	output, ok := outputs[key]
+	if !ok {
+		return fmt.Errorf("esbuild metafile: unknown output %q", key)
+	}
+
+	*files = append(*files, key)
+	if output.CSSBundle != "" {
+		*files = append(*files, output.CSSBundle)
+	}
+
+	for _, imp := range output.Imports {
+		if imp.External || imp.Kind != "import-statement" {
+			continue
+		}
+
+		if err := walkEsbuildOutput(outputs, imp.Path, visited, files); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// entryAliases are the short names of the entry points (e.g., "main"
+// for "src/main.ts").
+type entryAliases map[string]*entryAlias
+
+type entryAlias struct {
+	entry string
+	files []string
+
+	// ambiguous is set when the alias is shared
+	// by multiple entry points.
+	ambiguous bool
+}
+
+func (a entryAliases) add(alias, entry string, files []string) {
+	if prev, ok := a[alias]; ok {
+		if prev.entry != entry {
+			prev.ambiguous = true
+		}
+		return
+	}
+	a[alias] = &entryAlias{entry: entry, files: files}
+}
+
+// addTo adds the aliases to the manifest. Ambiguous aliases and aliases
+// which are same as the full names of the entry points are skipped.
+func (a entryAliases) addTo(m *Manifest) {
+	for alias, e := range a {
+		if _, ok := m.entries[alias]; ok || e.ambiguous {
+			continue
+		}
+
+		for _, file := range e.files {
+			m.add(alias, file)
+		}
+	}
+}
+
+// add adds the file to the assets of the entry if it's not added yet.
+func (m *Manifest) add(entry, file string) {
+	for _, f := range m.entries[entry] {
+		if f == file {
+			return
+		}
+	}
+	m.entries[entry] = append(m.entries[entry], file)
+}
+
+// publicURL returns the URL path of the output file.
+func publicURL(publicPath, file string) string {
+	if strings.HasPrefix(file, "/") || strings.Contains(file, "://") {
+		return file
+	}
+	return cleanPrefix(publicPath) + strings.TrimPrefix(file, "./")
+}
@@ -0,0 +1,259 @@
+package casper
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadWebpackManifest(t *testing.T) {
+	cases := []struct {
+		manifest string
+		opts     *ManifestOptions
+		entry    string
+		want     []string
+	}{
+		{
+			`{
+  "main.js": "/static/main.3f2a.js",
+  "main.js.map": "/static/main.3f2a.js.map",
+  "main.css": "/static/main.9b1c.css",
+  "vendor.js": "/static/vendor.77d0.js"
+}`,
+			nil,
+			"main",
+			[]string{"/static/main.9b1c.css", "/static/main.3f2a.js"},
+		},
+		{
+			`{
+  "main.js": "main.3f2a.js",
+  "vendor.js": "vendor.77d0.js"
+}`,
+			&ManifestOptions{PublicPath: "/static/"},
+			"vendor",
+			[]string{"/static/vendor.77d0.js"},
+		},
+		{
+			`{
+  "entrypoints": {
+    "main": ["vendor.77d0.js", "main.3f2a.js", "main.9b1c.css"]
+  }
+}`,
+			&ManifestOptions{PublicPath: "/static"},
+			"main",
+			[]string{"/static/vendor.77d0.js", "/static/main.3f2a.js", "/static/main.9b1c.css"},
+		},
+	}
+
+	for _, tc := range cases {
+		m, err := LoadWebpackManifest(strings.NewReader(tc.manifest), tc.opts)
+		if err != nil {
+			t.Fatalf("LoadWebpackManifest should not fail: %s", err)
+		}
+
+		got, err := m.EntryAssets(tc.entry)
+		if err != nil {
+			t.Fatalf("EntryAssets should not fail: %s", err)
+		}
+
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("EntryAssets(%q)=%v, want=%v", tc.entry, got, tc.want)
+		}
+	}
+}
+
+const testViteManifest = `{
+  "_shared.83069a53.js": {
+    "file": "assets/shared.83069a53.js",
+    "css": ["assets/shared.a834bfc3.css"],
+    "imports": ["_util.12ab34cd.js"]
+  },
+  "_util.12ab34cd.js": {
+    "file": "assets/util.12ab34cd.js",
+    "imports": ["_shared.83069a53.js"]
+  },
+  "views/foo.js": {
+    "file": "assets/foo.869aea0d.js",
+    "src": "views/foo.js",
+    "isDynamicEntry": true,
+    "imports": ["_shared.83069a53.js"]
+  },
+  "main.js": {
+    "file": "assets/main.4889e940.js",
+    "src": "main.js",
+    "isEntry": true,
+    "imports": ["_shared.83069a53.js"],
+    "dynamicImports": ["views/foo.js"],
+    "css": ["assets/main.b82dbe22.css"],
+    "assets": ["assets/logo.0ab0f9cd.png"]
+  }
+}`
+
+func TestLoadViteManifest(t *testing.T) {
+	m, err := LoadViteManifest(strings.NewReader(testViteManifest), &ManifestOptions{PublicPath: "/"})
+	if err != nil {
+		t.Fatalf("LoadViteManifest should not fail: %s", err)
+	}
+
+	want := []string{
+		"/assets/main.4889e940.js",
+		"/assets/main.b82dbe22.css",
+		"/assets/shared.83069a53.js",
+		"/assets/shared.a834bfc3.css",
+		"/assets/util.12ab34cd.js",
+		"/assets/logo.0ab0f9cd.png",
+	}
+
+	for _, entry := range []string{"main", "main.js"} {
+		got, err := m.EntryAssets(entry)
+		if err != nil {
+			t.Fatalf("EntryAssets should not fail: %s", err)
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("EntryAssets(%q)=%v, want=%v", entry, got, want)
+		}
+	}
+
+	// Dynamic entry is not an entry point.
+	if _, err := m.EntryAssets("foo"); err == nil {
+		t.Fatalf("EntryAssets should fail for dynamic entry")
+	}
+
+	// Ambiguous alias.
+	ambiguous := `{
+  "src/a/index.html": {"file": "assets/a.js", "src": "src/a/index.html", "isEntry": true},
+  "src/b/index.html": {"file": "assets/b.js", "src": "src/b/index.html", "isEntry": true}
+}`
+	m, err = LoadViteManifest(strings.NewReader(ambiguous), nil)
+	if err != nil {
+		t.Fatalf("LoadViteManifest should not fail: %s", err)
+	}
+
+	if got, want := m.Entries(), []string{"src/a/index.html", "src/b/index.html"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Entries=%v, want=%v", got, want)
+	}
+
+	if got, _ := m.EntryAssets("src/b/index.html"); !reflect.DeepEqual(got, []string{"/assets/b.js"}) {
+		t.Fatalf("EntryAssets=%v, want=[/assets/b.js]", got)
+	}
+
+	// Unknown import.
+	invalid := `{"main.js": {"file": "main.js", "isEntry": true, "imports": ["_missing.js"]}}`
+	if _, err := LoadViteManifest(strings.NewReader(invalid), nil); err == nil {
+		t.Fatalf("LoadViteManifest should fail for unknown import")
+	}
+}
+
+const testEsbuildMetafile = `{
+  "inputs": {},
+  "outputs": {
+    "out/main-ABCD1234.js": {
+      "entryPoint": "src/main.ts",
+      "cssBundle": "out/main-EFGH5678.css",
+      "bytes": 2048,
+      "imports": [
+        {"path": "out/chunk-IJKL9012.js", "kind": "import-statement"},
+        {"path": "out/lazy-MNOP3456.js", "kind": "dynamic-import"},
+        {"path": "https://cdn.example.com/lib.js", "kind": "import-statement", "external": true}
+      ]
+    },
+    "out/chunk-IJKL9012.js": {
+      "bytes": 512,
+      "imports": []
+    },
+    "out/lazy-MNOP3456.js": {
+      "imports": [
+        {"path": "out/chunk-IJKL9012.js", "kind": "import-statement"}
+      ]
+    },
+    "out/main-EFGH5678.css": {
+      "imports": []
+    }
+  }
+}`
+
+func TestLoadEsbuildMetafile(t *testing.T) {
+	m, err := LoadEsbuildMetafile(strings.NewReader(testEsbuildMetafile), &ManifestOptions{
+		PublicPath: "/static/",
+		OutDir:     "./out",
+	})
+	if err != nil {
+		t.Fatalf("LoadEsbuildMetafile should not fail: %s", err)
+	}
+
+	if got, want := m.Entries(), []string{"main", "src/main.ts"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Entries=%v, want=%v", got, want)
+	}
+
+	got, err := m.EntryAssets("main")
+	if err != nil {
+		t.Fatalf("EntryAssets should not fail: %s", err)
+	}
+
+	want := []string{
+		"/static/main-ABCD1234.js",
+		"/static/main-EFGH5678.css",
+		"/static/chunk-IJKL9012.js",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("EntryAssets=%v, want=%v", got, want)
+	}
+
+	if size, ok := m.Size("/static/main-ABCD1234.js"); !ok || size != 2048 {
+		t.Fatalf("Size=%d, %v, want=2048, true", size, ok)
+	}
+
+	if _, ok := m.Size("/static/unknown.js"); ok {
+		t.Fatalf("Size of unknown asset should not be found")
+	}
+
+	// Ambiguous alias.
+	ambiguous := `{"outputs": {
+  "out/a.js": {"entryPoint": "src/a/index.ts"},
+  "out/b.js": {"entryPoint": "src/b/index.ts"}
+}}`
+	m, err = LoadEsbuildMetafile(strings.NewReader(ambiguous), &ManifestOptions{OutDir: "out"})
+	if err != nil {
+		t.Fatalf("LoadEsbuildMetafile should not fail: %s", err)
+	}
+
+	if got, want := m.Entries(), []string{"src/a/index.ts", "src/b/index.ts"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Entries=%v, want=%v", got, want)
+	}
+
+	if got, _ := m.EntryAssets("src/a/index.ts"); !reflect.DeepEqual(got, []string{"/a.js"}) {
+		t.Fatalf("EntryAssets=%v, want=[/a.js]", got)
+	}
+}
+
+func TestPushEntry(t *testing.T) {
+	manifest, err := LoadViteManifest(strings.NewReader(testViteManifest), nil)
+	if err != nil {
+		t.Fatalf("LoadViteManifest should not fail: %s", err)
+	}
+
+	pusher, err := NewWithConfig(&Config{
+		P:        1 << 6,
+		N:        10,
+		Manifest: manifest,
+	})
+	if err != nil {
+		t.Fatalf("NewWithConfig should not fail: %s", err)
+	}
+
+	w := newPushRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	if _, err := pusher.PushEntry(w, req, "main", nil); err != nil {
+		t.Fatalf("PushEntry should not fail: %s", err)
+	}
+
+	if got, want := len(w.pushed), 6; got != want {
+		t.Fatalf("pushed %d assets, want %d", got, want)
+	}
+
+	if _, err := pusher.PushEntry(newPushRecorder(), req, "missing", nil); err == nil {
+		t.Fatalf("PushEntry should fail for unknown entry")
+	}
+}
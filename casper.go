@@ -15,7 +15,7 @@ Below is a simple example of usage.
 
       // Execute cache aware server push.
       //
-      // In this example, it generates a fingerprint "JA" and set it
+      // In this example, it generates a fingerprint "AUAKQMkA" and set it
       // as "x-go-casper" cookie value.
       //
       // If you access this handler first time, it runs server-push.
@@ -32,19 +32,18 @@ Below is a simple example of usage.
 package casper
 
 import (
-	"bytes"
 	"context"
 	"crypto/md5"
-	"encoding/base64"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
-	"sort"
 	"strconv"
 	"strings"
 
-	"github.com/tcnksm/go-casper/internal/encoding/golomb"
+	"github.com/tcnksm/go-casper/gcs"
+	"golang.org/x/net/http2"
 )
 
 const (
@@ -55,29 +54,196 @@ const (
 	// defaultCookiePath is default cookie path to be used for
 	// generating cookie to return.
 	defaultCookiePath = "/"
-)
 
-var (
-	// hashContextkey is used for storing hash values in context.Value
-	hashContextkey = &contextKey{"casper-hash"}
+	// maxCookieLength is the maximum length of cookie value to be
+	// decoded. Browsers don't store a cookie larger than 4096 bytes.
+	maxCookieLength = 4096
+
+	// maxEntriesFactor is the ratio of the maximum number of entries
+	// in the decoded fingerprint to n. Push evicts entries to keep the
+	// fingerprint within n (see EvictionPolicy), and it never encodes
+	// more than n*maxEntriesFactor entries. The margin accepts cookies
+	// generated with a larger n or by a request with more targets.
+	maxEntriesFactor = 2
 )
 
+// errPushNotSupported is returned by Push when the ResponseWriter
+// does not implement http.Pusher.
+var errPushNotSupported = errors.New("server push is not supported")
+
+// isPushLimitReached reports whether err means that the client does not
+// accept more pushed streams. The HTTP/2 server bundled in net/http has
+// its own unexported copy of http2.ErrPushLimitReached, so it's compared
+// by the message as well.
+func isPushLimitReached(err error) bool {
+	return err == http2.ErrPushLimitReached || err.Error() == http2.ErrPushLimitReached.Error()
+}
+
 // Casper provides a interface for cache-aware HTTP/2 server push.
 type Casper struct {
 	p uint
 	n uint
 
+	// m is the golomb parameter for encoding fingerprint.
+	m uint
+
+	cookieName string
+	cookiePath string
+
+	// assets are pushed by PushAssets.
+	assets []string
+
+	// manifest is used for pushing entry assets by PushEntry.
+	manifest *Manifest
+
+	// catalog is used for versioning the fingerprint
+	// entries by the content hash.
+	catalog *Catalog
+
+	// unknownTargets decides how to handle the pushed
+	// targets which are not in the catalog.
+	unknownTargets UnknownTargetPolicy
+
+	// fingerprintContextKey is used for storing fingerprint
+	// in context.Value. It's unique to each casper.
+	fingerprintContextKey *contextKey
+
+	// resultsContextKey is used for storing push results
+	// in context.Value. It's unique to each casper.
+	resultsContextKey *contextKey
+
+	// maxPushes and maxPushBytes are the push budget of a
+	// request. If zero, it's unlimited.
+	maxPushes    int
+	maxPushBytes int64
+
+	// maxConnPushes and maxConnPushBytes are the push budget
+	// of a connection. If zero, it's unlimited.
+	maxConnPushes    int
+	maxConnPushBytes int64
+
+	// eviction decides which fingerprint entries are
+	// evicted when the fingerprint is full.
+	eviction EvictionPolicy
+
+	// known are the current assets by their hash values.
+	// It's used for evicting stale entries.
+	known map[uint]string
+
+	// onEvict is called with the evicted entries.
+	onEvict func(r *http.Request, evicted []PushResult)
+
+	// pushStatuses are the response statuses for which
+	// the deferred pushes run (see DeferPush).
+	pushStatuses []int
+
+	// recordNotModified records the deferred targets when
+	// the conditional request is answered by 304.
+	recordNotModified bool
+
 	// buf is last assets pushed by a call to Push.
 	buf []string
+}
 
-	// skipPush decides executing actual server push or not. This should
-	// be used only in testing.
-	//
-	// Currently, it's kinda hard to receive http push in go http client.
-	// This should be removed in future.
-	skipPush bool
+// Config is a configuration for Casper.
+type Config struct {
+	// P is the inverse of false positive probability (1/P).
+	P int
+
+	// N is the number of contents to be tracked by the fingerprint.
+	// It's the capacity of the fingerprint. When more contents are
+	// pushed, the entries are evicted by Eviction.
+	N int
+
+	// M is the golomb parameter used for encoding the fingerprint.
+	// It can be any positive number (it does not need to be power
+	// of two). If zero, P is used. The size of the fingerprint is
+	// minimum when M is about P*ln(2).
+	M int
+
+	// CookieName is the name of cookie for storing the fingerprint.
+	// If empty, "x-go-casper" is used.
+	CookieName string
+
+	// CookiePath is the path of cookie for storing the fingerprint.
+	// If empty, "/" is used.
+	CookiePath string
+
+	// Assets is the asset manifest, the list of assets to be pushed
+	// by PushAssets.
+	Assets []string
+
+	// Manifest is the bundler manifest used by PushEntry.
+	// See LoadWebpackManifest, LoadViteManifest and LoadEsbuildMetafile.
+	Manifest *Manifest
+
+	// Catalog is the catalog of the static files. If set, the content
+	// hash of the target is used for its fingerprint entry, so the
+	// target is pushed again when its content is changed. The target
+	// can be either the path or the hashed path of the asset.
+	Catalog *Catalog
+
+	// UnknownTargets decides how Push handles the targets which are
+	// not in the Catalog. By default, they are pushed without warning.
+	UnknownTargets UnknownTargetPolicy
+
+	// Eviction decides which fingerprint entries are evicted when the
+	// fingerprint is full. By default, EvictStale is used.
+	Eviction EvictionPolicy
+
+	// OnEvict is called with the entries evicted from the fingerprint
+	// of the request. Push also reports them by Results, but the
+	// evictions by the asset server (see FileServerOptions.Casper) and
+	// DeferPush are reported only by OnEvict. It must be safe for
+	// concurrent use.
+	OnEvict func(r *http.Request, evicted []PushResult)
+
+	// MaxPushes is the maximum number of targets pushed for a request
+	// (including the calls to Push with the request returned by Push).
+	// The targets are pushed in the given order until the budget runs
+	// out. The rest of the targets are not pushed nor recorded in the
+	// fingerprint, and they are reported as PushStatusBudget (see
+	// Results). If zero, it's unlimited.
+	MaxPushes int
+
+	// MaxPushBytes is the maximum total size of the targets pushed for
+	// a request. The size is taken from the Catalog or the Manifest
+	// (esbuild metafile only). The targets of unknown size count as
+	// zero bytes. If zero, it's unlimited.
+	MaxPushBytes int64
+
+	// MaxConnPushes and MaxConnPushBytes are like MaxPushes and
+	// MaxPushBytes but for all requests on a connection. They require
+	// ConnContext (see ConfigureServer). If zero, it's unlimited.
+	MaxConnPushes    int
+	MaxConnPushBytes int64
+
+	// PushStatuses are the response statuses for which the deferred
+	// pushes run (see DeferPush). If empty, 200 is used.
+	PushStatuses []int
+
+	// RecordNotModified adds the deferred targets to the fingerprint
+	// without pushing them when the conditional request for the page is
+	// answered by 304 (see DeferPush). It restores the fingerprint when
+	// the cookie was lost while the page is still cached by the client.
+	RecordNotModified bool
 }
 
+// UnknownTargetPolicy decides how to handle the pushed targets
+// which are not in the catalog.
+type UnknownTargetPolicy int
+
+const (
+	// UnknownTargetIgnore pushes unknown targets without warning.
+	UnknownTargetIgnore UnknownTargetPolicy = iota
+
+	// UnknownTargetWarn pushes unknown targets and logs a warning.
+	UnknownTargetWarn
+
+	// UnknownTargetError returns an error without pushing anything.
+	UnknownTargetError
+)
+
 // Options includes casper push options.
 type Options struct {
 	*http.PushOptions
@@ -97,9 +263,79 @@ func New(p, n int) *Casper {
 	return &Casper{
 		p: uint(p),
 		n: uint(n),
+		m: uint(p),
+
+		cookieName: defaultCookieName,
+		cookiePath: defaultCookiePath,
+
+		fingerprintContextKey: &contextKey{"casper-fingerprint"},
+		resultsContextKey:     &contextKey{"casper-results"},
 	}
 }
 
+// NewWithConfig returns a new casper with the given configuration.
+func NewWithConfig(config *Config) (*Casper, error) {
+	if config.P <= 0 {
+		return nil, errors.New("P must be positive")
+	}
+
+	if config.N <= 0 {
+		return nil, errors.New("N must be positive")
+	}
+
+	if config.M < 0 {
+		return nil, errors.New("M must not be negative")
+	}
+
+	c := New(config.P, config.N)
+	if config.M != 0 {
+		c.m = uint(config.M)
+	}
+
+	if config.CookieName != "" {
+		c.cookieName = config.CookieName
+		c.fingerprintContextKey = &contextKey{"casper-fingerprint-" + config.CookieName}
+		c.resultsContextKey = &contextKey{"casper-results-" + config.CookieName}
+	}
+
+	if config.CookiePath != "" {
+		c.cookiePath = config.CookiePath
+	}
+
+	c.assets = config.Assets
+	c.manifest = config.Manifest
+	c.catalog = config.Catalog
+	c.unknownTargets = config.UnknownTargets
+	c.eviction = config.Eviction
+	c.known = c.knownTargets()
+	c.onEvict = config.OnEvict
+
+	if config.MaxPushes < 0 {
+		return nil, errors.New("MaxPushes must not be negative")
+	}
+	c.maxPushes = config.MaxPushes
+
+	if config.MaxPushBytes < 0 {
+		return nil, errors.New("MaxPushBytes must not be negative")
+	}
+	c.maxPushBytes = config.MaxPushBytes
+
+	if config.MaxConnPushes < 0 {
+		return nil, errors.New("MaxConnPushes must not be negative")
+	}
+	c.maxConnPushes = config.MaxConnPushes
+
+	if config.MaxConnPushBytes < 0 {
+		return nil, errors.New("MaxConnPushBytes must not be negative")
+	}
+	c.maxConnPushBytes = config.MaxConnPushBytes
+
+	c.pushStatuses = config.PushStatuses
+	c.recordNotModified = config.RecordNotModified
+
+	return c, nil
+}
+
 // Push initiates an HTTP/2 server push using the given targets and options.
 // Internally, it just calls go's standard server push method (which was added
 // from go1.8).
@@ -110,73 +346,177 @@ func New(p, n int) *Casper {
 // So from next time when the server receives a request, it checks the cookie
 // and determine to push or not the given targets.
 //
+// The cookie value has a header which includes the format version and the
+// casper parameters (p, n and the golomb parameter). When they are changed,
+// the old fingerprint is converted (if possible) or discarded instead of
+// being misinterpreted.
+//
+// If w is wrapped by middleware, Push finds the http.Pusher through the
+// Unwrap method of the wrappers (see ResponseWriter). If w is wrapped by
+// DeferPush, the targets are pushed when the response status is known.
+//
+// The targets are pushed in the given order (highest priority first) until
+// the push budget runs out (see Config.MaxPushes and Config.MaxPushBytes).
+// What happened to each target is reported by Results.
+//
 // [1]: https://en.wikipedia.org/wiki/Golomb_coding
 func (c *Casper) Push(w http.ResponseWriter, r *http.Request, targets []string, opts *Options) (*http.Request, error) {
 	// Empty buffer.
 	c.buf = make([]string, 0, len(targets))
 
+	// The server does not allow server push (see ServerOptions).
+	if contextPushDisabled(r.Context()) {
+		return r, nil
+	}
+
+	// Pushes are run when the response status is known.
+	if dw, ok := findDeferredWriter(c, w); ok {
+		dw.enqueue(r, targets, opts)
+		return r, nil
+	}
+
 	// Pusher is used later in this function but should check
 	// it's available or not first to avoid unnessary calc.
-	pusher, ok := w.(http.Pusher)
+	pusher, ok := findPusher(w)
 	if !ok {
-		return r, errors.New("server push is not supported") // go1.8 or later
+		return r, errPushNotSupported // go1.8 or later
 	}
 
-	if opts == nil {
-		opts = &Options{}
+	if err := c.checkTargets(targets); err != nil {
+		return r, err
 	}
 
-	// Remove casper cookie header if it's already exists.
-	if cookies, ok := w.Header()["Set-Cookie"]; ok && len(cookies) != 0 {
-		w.Header().Del("Set-Cookie")
-		for _, cookieStr := range cookies {
-			if strings.Contains(cookieStr, defaultCookieName+"=") {
-				continue
-			}
-			w.Header().Add("Set-Cookie", cookieStr)
-		}
+	if opts == nil {
+		opts = &Options{}
 	}
 
-	// Get hash values assosiated with previous parent context.
+	// Get fingerprint assosiated with previous parent context.
 	// If none, then read it from the request cookie.
-	hashValues := contextHashValues(r.Context())
-	if hashValues == nil {
+	fingerprint := c.contextFingerprint(r.Context())
+	if fingerprint == nil {
 		var err error
-		hashValues, err = c.readCookie(r)
-		if err != nil {
+		fingerprint, err = c.readCookie(r)
+		if _, ok := err.(*gcs.DecodeError); ok {
+			// The cookie is broken or generated by an incompatible
+			// casper. Start over, the cookie is replaced below.
+			fingerprint = gcs.New(c.m)
+		} else if err != nil {
 			return r, err
 		}
+	} else {
+		// Copy it so that the parent context is not modified.
+		fingerprint = fingerprint.Clone()
 	}
 
+	// Targets pushed on the connection by other requests.
+	connPushes := contextConnPushes(r.Context())
+
+	// Results of the previous calls for the request. Copy them
+	// so that the parent context is not modified.
+	results := append([]PushResult(nil), c.contextResults(r.Context())...)
+	budget := c.newPushBudget(r.Context(), results)
+
 	// Push contents one by one.
 	// TODO(tcnksm): Is it possible to push concurrently ?
 	for _, content := range targets {
-		h := c.hash([]byte(content))
+		h := c.hashTarget(content)
+		result := PushResult{Target: content, Hash: h, Size: c.assetSize(content)}
 
 		// Check the content is already pushed or not.
-		if search(hashValues, h) {
+		if fingerprint.Contains(h) {
+			result.Status = PushStatusCached
+			results = append(results, result)
+			continue
+		}
+
+		if !budget.reserve(result.Size) {
+			result.Status = PushStatusBudget
+			results = append(results, result)
 			continue
 		}
 
-		if !c.skipPush {
-			if err := pusher.Push(content, opts.PushOptions); err != nil {
-				return r, err
+		if connPushes != nil {
+			switch connPushes.reserve(content, result.Size, c.maxConnPushes, c.maxConnPushBytes) {
+			case PushStatusConnection:
+				// Already pushed on the connection but the
+				// cookie does not reflect it yet.
+				budget.release(result.Size)
+				fingerprint.Add(h)
+				result.Status = PushStatusConnection
+				results = append(results, result)
+				continue
+			case PushStatusBudget:
+				budget.release(result.Size)
+				budget.exhausted = true
+				result.Status = PushStatusBudget
+				results = append(results, result)
+				continue
 			}
 		}
 
+		if err := pusher.Push(content, opts.PushOptions); err != nil {
+			budget.release(result.Size)
+			if connPushes != nil {
+				connPushes.release(content)
+			}
+
+			// The client does not accept more pushed streams now.
+			if isPushLimitReached(err) {
+				budget.exhausted = true
+				result.Status = PushStatusBudget
+				results = append(results, result)
+				continue
+			}
+			return r, err
+		}
+
 		// also pushed in memory buffer
 		c.buf = append(c.buf, content)
-		hashValues = append(hashValues, h)
+		fingerprint.Add(h)
+		result.Status = PushStatusPushed
+		results = append(results, result)
 	}
 
+	// Keep the fingerprint within the capacity. The targets
+	// of the request are kept in priority order.
+	var current []PushResult
+	for _, result := range results {
+		switch result.Status {
+		case PushStatusPushed, PushStatusCached, PushStatusConnection:
+			current = append(current, result)
+		}
+	}
+	evicted := c.evict(fingerprint, current)
+	results = append(results, evicted...)
+	c.reportEvicted(r, evicted)
+
 	// TODO(tcnksm): Can be skip when nothing is pushed.
-	cookie, err := c.generateCookie(hashValues)
-	if err != nil {
+	if err := c.setCookie(w, fingerprint); err != nil {
 		return r, err
 	}
-	http.SetCookie(w, cookie)
 
-	return r.WithContext(withHashValues(r.Context(), hashValues)), nil
+	ctx := c.withResults(c.withFingerprint(r.Context(), fingerprint), results)
+	return r.WithContext(ctx), nil
+}
+
+// PushAssets is like Push but pushes the assets in the
+// asset manifest (Config.Assets).
+func (c *Casper) PushAssets(w http.ResponseWriter, r *http.Request, opts *Options) (*http.Request, error) {
+	return c.Push(w, r, c.assets, opts)
+}
+
+// PushEntry is like Push but pushes the assets of the given
+// entry point in the bundler manifest (Config.Manifest).
+func (c *Casper) PushEntry(w http.ResponseWriter, r *http.Request, entry string, opts *Options) (*http.Request, error) {
+	if c.manifest == nil {
+		return r, errors.New("no bundler manifest")
+	}
+
+	targets, err := c.manifest.EntryAssets(entry)
+	if err != nil {
+		return r, err
+	}
+	return c.Push(w, r, targets, opts)
 }
 
 // Pushed returns the most recent assets pushed by a call to Push.
@@ -185,6 +525,113 @@ func (c *Casper) Pushed() []string {
 	return c.buf
 }
 
+// GenerateCookie returns the fingerprint cookie which the client holds
+// after the given targets are pushed to it (or fetched by it). It's
+// identical to the cookie set by Push without the cookie (including
+// evictions when the targets exceed the capacity) and can be used for
+// testing.
+func (c *Casper) GenerateCookie(targets []string) (*http.Cookie, error) {
+	fingerprint := gcs.New(c.m)
+	current := make([]PushResult, 0, len(targets))
+	for _, target := range targets {
+		h := c.hashTarget(target)
+		fingerprint.Add(h)
+		current = append(current, PushResult{Target: target, Hash: h})
+	}
+
+	c.evict(fingerprint, current)
+	return c.generateCookie(fingerprint)
+}
+
+// record adds the given targets to the client fingerprint without
+// pushing them. It's used when the client fetches the targets by
+// itself. An invalid fingerprint cookie is replaced.
+func (c *Casper) record(w http.ResponseWriter, r *http.Request, targets ...string) error {
+	fingerprint := c.contextFingerprint(r.Context())
+	if fingerprint == nil {
+		var err error
+		fingerprint, err = c.readCookie(r)
+		if err != nil {
+			fingerprint = gcs.New(c.m)
+		}
+	} else {
+		fingerprint = fingerprint.Clone()
+	}
+
+	var added bool
+	current := make([]PushResult, 0, len(targets))
+	for _, target := range targets {
+		h := c.hashTarget(target)
+		current = append(current, PushResult{Target: target, Hash: h})
+		if fingerprint.Add(h) {
+			added = true
+		}
+	}
+
+	if !added {
+		return nil
+	}
+	c.reportEvicted(r, c.evict(fingerprint, current))
+	return c.setCookie(w, fingerprint)
+}
+
+// Cached reports whether the fingerprint of the given request indicates
+// the target has already been cached by the client. It queries the encoded
+// cookie value directly and stops decoding once the target is found (or
+// passed), so it's cheaper than decoding the whole fingerprint.
+func (c *Casper) Cached(r *http.Request, target string) (bool, error) {
+	h := c.hashTarget(target)
+
+	// Fingerprint assosiated with previous Push call.
+	if fingerprint := c.contextFingerprint(r.Context()); fingerprint != nil {
+		return fingerprint.Contains(h), nil
+	}
+
+	cookie, err := r.Cookie(c.cookieName)
+	if err == http.ErrNoCookie {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("failed to read cookie: %s", err)
+	}
+
+	body, header, err := c.decodeHeader(cookie.Value)
+	if _, ok := err.(*gcs.DecodeError); ok {
+		// Invalid fingerprint. It's same as no fingerprint.
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if body == nil {
+		// Unknown format. It's same as no fingerprint.
+		return false, nil
+	}
+
+	if header != c.header() {
+		// Fingerprint needs to be migrated.
+		fingerprint, err := c.decodeFingerprint(cookie.Value)
+		if _, ok := err.(*gcs.DecodeError); ok {
+			return false, nil
+		}
+
+		if err != nil {
+			return false, err
+		}
+		return fingerprint.Contains(h), nil
+	}
+
+	limits := c.limits()
+	ok, err := gcs.ContainsEncoded(body, c.m, h, &limits)
+	if _, invalid := err.(*gcs.DecodeError); invalid {
+		return false, nil
+	}
+	return ok, err
+}
+
 // hash generate a hash value from the given bytes for
 // n elements and p faslse positive probability.
 //
@@ -203,79 +650,111 @@ func (c *Casper) hash(p []byte) uint {
 	return uint(i) % (c.n * c.p)
 }
 
-// generateCookie generates cookie from the given hash values.
-func (c *Casper) generateCookie(hashValues []uint) (*http.Cookie, error) {
+// hashTarget returns the hash value of the target. If the target is in the
+// catalog, its content hash is also used, so the target is pushed again when
+// its content is changed.
+func (c *Casper) hashTarget(target string) uint {
+	if c.catalog != nil {
+		if asset, ok := c.catalog.Lookup(target); ok {
+			return c.hash([]byte(asset.Path + "#" + asset.Hash))
+		}
+	}
+	return c.hash([]byte(target))
+}
+
+// checkTargets handles the targets which are not in the catalog
+// by the unknown target policy.
+func (c *Casper) checkTargets(targets []string) error {
+	if c.catalog == nil || c.unknownTargets == UnknownTargetIgnore {
+		return nil
+	}
 
-	// golomb encoder expect the given array is sorted.
-	sort.Slice(hashValues, func(i, j int) bool {
-		return hashValues[i] < hashValues[j]
-	})
+	err := c.catalog.Validate(targets)
+	if err == nil {
+		return nil
+	}
 
-	var buf bytes.Buffer
-	encoder := base64.NewEncoder(base64.RawURLEncoding, &buf)
-	if err := golomb.Encode(encoder, hashValues, c.p); err != nil {
-		return nil, fmt.Errorf("failed golomb coding: %s", err)
+	if c.unknownTargets == UnknownTargetError {
+		return err
+	}
+	log.Printf("[WARN] casper: %s", err)
+	return nil
+}
+
+// setCookie generates cookie from the given fingerprint and sets it to
+// the response. It replaces the cookie which is already set.
+func (c *Casper) setCookie(w http.ResponseWriter, fingerprint *gcs.Set) error {
+	cookie, err := c.generateCookie(fingerprint)
+	if err != nil {
+		return err
+	}
+
+	// Remove casper cookie header if it's already exists.
+	if cookies, ok := w.Header()["Set-Cookie"]; ok && len(cookies) != 0 {
+		w.Header().Del("Set-Cookie")
+		for _, cookieStr := range cookies {
+			if strings.HasPrefix(cookieStr, c.cookieName+"=") {
+				continue
+			}
+			w.Header().Add("Set-Cookie", cookieStr)
+		}
 	}
 
-	if err := encoder.Close(); err != nil {
-		return nil, fmt.Errorf("failed to close encoder: %s", err)
+	http.SetCookie(w, cookie)
+	return nil
+}
+
+// generateCookie generates cookie from the given fingerprint.
+func (c *Casper) generateCookie(fingerprint *gcs.Set) (*http.Cookie, error) {
+	value, err := c.encodeFingerprint(fingerprint)
+	if err != nil {
+		return nil, err
 	}
 
 	return &http.Cookie{
-		Name:  defaultCookieName,
-		Value: buf.String(),
+		Name:  c.cookieName,
+		Value: value,
 
-		Path: defaultCookiePath,
+		Path: c.cookiePath,
 	}, nil
 }
 
-// readCookie reads cookie from http request and decode it to hash array.
-func (c *Casper) readCookie(r *http.Request) ([]uint, error) {
-	cookie, err := r.Cookie(defaultCookieName)
+// readCookie reads cookie from http request and decode it to fingerprint.
+func (c *Casper) readCookie(r *http.Request) (*gcs.Set, error) {
+	cookie, err := r.Cookie(c.cookieName)
 	if err != nil && err != http.ErrNoCookie {
 		return nil, fmt.Errorf("failed to read cookie: %s", err)
 	}
 
 	if err == http.ErrNoCookie {
-		hashValues := make([]uint, 0, c.n)
-		return hashValues, nil
+		return gcs.New(c.m), nil
 	}
 
-	// Decode golomb coded cookie value to original hash values array.
-	decoder := base64.NewDecoder(base64.RawURLEncoding, strings.NewReader(cookie.Value))
-	hashValues, err := golomb.DecodeAll(decoder, c.p)
-	if err != nil {
-		return nil, fmt.Errorf("failed golomb decoding: %s", err)
-	}
-
-	return hashValues, nil
+	// Decode golomb coded cookie value to original hash values.
+	// Cookie value is controlled by the client. Limit the work to decode
+	// it and reject values which can not be generated by this casper.
+	// It returns *gcs.DecodeError when the value is invalid.
+	return c.decodeFingerprint(cookie.Value)
 }
 
-// withHashValues returns a new context based on previsous parent context.
-// It sets hashValues which is used for generating golomb encoded cookie value.
-func withHashValues(parent context.Context, hashValues []uint) context.Context {
-	return context.WithValue(parent, hashContextkey, hashValues)
+// limits returns the limits for decoding the fingerprint cookie.
+func (c *Casper) limits() gcs.Limits {
+	return gcs.Limits{
+		MaxTextLen: maxCookieLength,
+		MaxLen:     int(c.n) * maxEntriesFactor,
+		MaxValue:   c.n * c.p,
+	}
 }
 
-// contextHashValues returns the hashValues assosiated with the
-// provided context. If none, it returns nil,
-func contextHashValues(ctx context.Context) []uint {
-	hashValues, _ := ctx.Value(hashContextkey).([]uint)
-	return hashValues
+// withFingerprint returns a new context based on previsous parent context.
+// It sets fingerprint which is used for generating golomb encoded cookie value.
+func (c *Casper) withFingerprint(parent context.Context, fingerprint *gcs.Set) context.Context {
+	return context.WithValue(parent, c.fingerprintContextKey, fingerprint)
 }
 
-// search looks up the provided slices contains the given value.
-//
-// TODO(tcnksm): binary search (or enable to configure?)
-func search(a []uint, h uint) bool {
-	for i := 0; i < len(a); i++ {
-		if h == a[i] {
-			return true
-		}
-
-		if h < a[i] {
-			return false
-		}
-	}
-	return false
+// contextFingerprint returns the fingerprint assosiated with the
+// provided context. If none, it returns nil,
+func (c *Casper) contextFingerprint(ctx context.Context) *gcs.Set {
+	fingerprint, _ := ctx.Value(c.fingerprintContextKey).(*gcs.Set)
+	return fingerprint
 }
@@ -1,13 +1,14 @@
 package casper
 
 import (
-	"crypto/tls"
+	"encoding/base64"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 
-	"golang.org/x/net/http2"
+	"github.com/tcnksm/go-casper/gcs"
 )
 
 func TestGenerateCookie(t *testing.T) {
@@ -88,264 +89,264 @@ func TestGenerateCookie(t *testing.T) {
 	for _, tc := range cases {
 		casper := New(tc.P, len(tc.assets))
 
-		hashValues := make([]uint, 0, len(tc.assets))
+		fingerprint := gcs.New(casper.m)
 		for _, content := range tc.assets {
-			hashValues = append(hashValues, casper.hash([]byte(content)))
+			fingerprint.Add(casper.hash([]byte(content)))
 		}
 
-		cookie, err := casper.generateCookie(hashValues)
+		cookie, err := casper.generateCookie(fingerprint)
 		if err != nil {
 			t.Fatalf("generateCookie should not fail")
 		}
 
-		if got, want := cookie.Value, tc.cookieValue; got != want {
+		if got, want := cookie.Value, cookieValue(casper, tc.cookieValue); got != want {
 			t.Fatalf("generateCookie=%q, want=%q", got, want)
 		}
 	}
 }
 
-func TestPush(t *testing.T) {
-	cases := []struct {
-		p        int
-		push     []string
-		sameTime bool
+// cookieValue returns the cookie value generated by the given casper
+// whose golomb-coded part is body (base64url encoded).
+func cookieValue(c *Casper, body string) string {
+	b, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(append(c.header().appendTo(nil), b...))
+}
 
-		clientCookie *http.Cookie
-		serverCookie *http.Cookie
+func TestCookie_GolombParameter(t *testing.T) {
+	assets := []string{
+		"/js/jquery-1.9.1.min.js",
+		"/assets/style.css",
+		"/static/logo.jpg",
+		"/static/cover.jpg",
+	}
 
-		casperCookie *http.Cookie
-		pushed       []string
-	}{
-		{
-			1 << 6,
-			[]string{"/static/example.jpg"},
-			false,
-			nil,
-			nil,
-
-			&http.Cookie{
-				Name:  defaultCookieName,
-				Value: "KA",
-				Path:  defaultCookiePath,
-			},
-			[]string{"/static/example.jpg"},
-		},
+	for _, m := range []int{0, 1 << 6, 44, 48, 100} {
+		casper, err := NewWithConfig(&Config{
+			P: 1 << 6,
+			N: len(assets),
+			M: m,
+		})
+		if err != nil {
+			t.Fatalf("NewWithConfig should not fail: %s", err)
+		}
 
-		{
-			1 << 6,
-			[]string{"/static/example.jpg"},
-			true, // push one by one
-			nil,
-			nil,
-
-			&http.Cookie{
-				Name:  defaultCookieName,
-				Value: "KA",
-				Path:  defaultCookiePath,
-			},
-			[]string{"/static/example.jpg"},
-		},
+		fingerprint := gcs.New(casper.m)
+		for _, content := range assets {
+			fingerprint.Add(casper.hash([]byte(content)))
+		}
 
-		{
-			1 << 6,
-			[]string{
-				"/js/jquery-1.9.1.min.js",
-				"/assets/style.css",
-				"/static/logo.jpg",
-				"/static/cover.jpg",
-			},
-			false,
-			nil,
-			nil,
-
-			&http.Cookie{
-				Name:  defaultCookieName,
-				Value: "gU54MA",
-				Path:  defaultCookiePath,
-			},
-			[]string{
-				"/js/jquery-1.9.1.min.js",
-				"/assets/style.css",
-				"/static/logo.jpg",
-				"/static/cover.jpg",
-			},
-		},
+		cookie, err := casper.generateCookie(fingerprint)
+		if err != nil {
+			t.Fatalf("generateCookie should not fail: %s", err)
+		}
 
-		// With additional server side cookies
-		{
-			1 << 6,
-			[]string{"/static/example.jpg"},
-			false,
-			nil,
-			&http.Cookie{
-				Name:  "session",
-				Value: "BAh7CiIKZmxhc2hJ",
-				Path:  "/",
-			},
+		// Power of two parameter generates the same cookie as before.
+		if m == 0 || m == 1<<6 {
+			if got, want := cookie.Value, cookieValue(casper, "gU54MA"); got != want {
+				t.Fatalf("generateCookie=%q, want=%q", got, want)
+			}
+		}
 
-			&http.Cookie{
-				Name:  defaultCookieName,
-				Value: "KA",
-				Path:  defaultCookiePath,
-			},
-			[]string{"/static/example.jpg"},
-		},
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.AddCookie(cookie)
+		got, err := casper.readCookie(req)
+		if err != nil {
+			t.Fatalf("readCookie should not fail: %s", err)
+		}
 
-		// With client side cookies
-		{
-			1 << 6,
-			[]string{
-				"/js/jquery-1.9.1.min.js",
-				"/assets/style.css",
-				"/static/logo.jpg",
-				"/static/cover.jpg",
-			},
-			false,
-
-			// This cookie is generated by /js/jquery-1.9.1.min.js and /assets/style.css
-			// This means these are already pushed on previous request and should not
-			// be pushed this time.
-			&http.Cookie{
-				Name:  defaultCookieName,
-				Value: "gU4",
-			},
-			nil,
+		if !reflect.DeepEqual(got.Values(), fingerprint.Values()) {
+			t.Fatalf("readCookie=%v, want=%v", got.Values(), fingerprint.Values())
+		}
+	}
+}
 
-			&http.Cookie{
-				Name:  defaultCookieName,
-				Value: "gU54MA",
-				Path:  defaultCookiePath,
-			},
-			[]string{
-				"/static/logo.jpg",
-				"/static/cover.jpg",
-			},
-		},
+func TestNewWithConfig_Invalid(t *testing.T) {
+	cases := []*Config{
+		{P: 0, N: 10},
+		{P: 1 << 6, N: 0},
+		{P: 1 << 6, N: 10, M: -1},
+	}
 
-		{
-			1 << 6,
-			[]string{
-				"/js/jquery-1.9.1.min.js",
-				"/assets/style.css",
-				"/static/logo.jpg",
-				"/static/cover.jpg",
-			},
-			true, // push one by one
-
-			// This cookie is generated by /js/jquery-1.9.1.min.js and /assets/style.css
-			// This means these are already pushed on previous request and should not
-			// be pushed this time.
-			&http.Cookie{
-				Name:  defaultCookieName,
-				Value: "gU4",
-			},
-			nil,
+	for _, config := range cases {
+		if _, err := NewWithConfig(config); err == nil {
+			t.Errorf("NewWithConfig(%#v) should fail", config)
+		}
+	}
+}
 
-			&http.Cookie{
-				Name:  defaultCookieName,
-				Value: "gU54MA",
-				Path:  defaultCookiePath,
-			},
-			[]string{
-				"/static/logo.jpg",
-				"/static/cover.jpg",
-			},
-		},
+func TestCached(t *testing.T) {
+	casper := New(1<<6, 4)
 
-		// With server and client cookies
-		{
-			1 << 6,
-			[]string{
-				"/js/jquery-1.9.1.min.js",
-				"/assets/style.css",
-				"/static/logo.jpg",
-				"/static/cover.jpg",
-			},
-			false,
-
-			// This cookie is generated by /js/jquery-1.9.1.min.js and /assets/style.css
-			// This means these are already pushed on previous request and should not
-			// be pushed this time.
-			&http.Cookie{
-				Name:  defaultCookieName,
-				Value: "gU4",
-			},
+	// This cookie is generated by /js/jquery-1.9.1.min.js and /assets/style.css
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{
+		Name:  defaultCookieName,
+		Value: cookieValue(casper, "gU4"),
+	})
 
-			&http.Cookie{
-				Name:  "session",
-				Value: "BAh7CiIKZmxhc2hJ",
-				Path:  "/",
-			},
-
-			&http.Cookie{
-				Name:  defaultCookieName,
-				Value: "gU54MA",
-				Path:  defaultCookiePath,
-			},
-			[]string{
-				"/static/logo.jpg",
-				"/static/cover.jpg",
-			},
-		},
+	cases := []struct {
+		target string
+		want   bool
+	}{
+		{"/js/jquery-1.9.1.min.js", true},
+		{"/assets/style.css", true},
+		{"/static/logo.jpg", false},
+		{"/static/cover.jpg", false},
 	}
 
 	for _, tc := range cases {
-		pusher := New(tc.p, len(tc.push))
-		pusher.skipPush = true
-
-		testServer := newTestServer(t, pusher, tc.push, tc.sameTime, tc.serverCookie)
-		defer testServer.Close()
-
-		req, err := http.NewRequest("GET", testServer.URL, nil)
+		got, err := casper.Cached(req, tc.target)
 		if err != nil {
-			t.Fatal(err)
+			t.Fatalf("Cached should not fail: %s", err)
 		}
 
-		if tc.clientCookie != nil {
-			req.AddCookie(tc.clientCookie)
+		if got != tc.want {
+			t.Errorf("Cached(%q)=%v, want=%v", tc.target, got, tc.want)
 		}
+	}
+}
 
-		client := newTestH2Client(t)
-		res, err := client.Do(req)
-		if err != nil {
-			t.Fatal(err)
+func TestReadCookie_Invalid(t *testing.T) {
+	cases := []string{
+		// Too long
+		strings.Repeat("A", maxCookieLength+1),
+
+		// Too many entries
+		"FmDhUxQHeuwQYINoQrxmr1g_iw",
+
+		// Out of range
+		"MMOJEkWo",
+
+		// Long unary code
+		"_____________________w",
+
+		// Invalid base64
+		"gU4!",
+	}
+
+	casper := New(1<<6, 4)
+	for i, value := range cases {
+		if i > 0 && i < len(cases)-1 {
+			value = cookieValue(casper, value)
 		}
-		defer res.Body.Close()
 
-		// Inspect pushed contents
-		// TODO(tcnksm): Separate test push one by one and push same time.
-		n := len(tc.pushed)
-		if !tc.sameTime {
-			n = 1
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.AddCookie(&http.Cookie{
+			Name:  defaultCookieName,
+			Value: value,
+		})
+
+		_, err := casper.readCookie(req)
+		if _, ok := err.(*gcs.DecodeError); !ok {
+			t.Errorf("readCookie(%q) should return *gcs.DecodeError: %v", value, err)
 		}
-		if got, want := len(pusher.Pushed()), n; got != want {
-			t.Fatalf("number of pushed contents %d, want %d", got, want)
+
+		// Invalid fingerprint is same as no fingerprint.
+		if cached, err := casper.Cached(req, "/static/example.js"); err != nil || cached {
+			t.Errorf("Cached(%q)=%v, %v, want=false, nil", value, cached, err)
 		}
 
-		if tc.sameTime {
-			if got, want := pusher.Pushed(), tc.pushed; !reflect.DeepEqual(got, want) {
-				t.Fatalf("number of pushed contents %v, want %v", got, want)
-			}
+		// Push replaces the invalid cookie.
+		w := newPushRecorder()
+		if _, err := casper.Push(w, req, []string{"/static/example.js"}, nil); err != nil {
+			t.Errorf("Push(%q) should not fail: %s", value, err)
+			continue
 		}
 
-		// Inspect cookies to be returned from server.
-		wantCookie := 1
-		if tc.serverCookie != nil {
-			wantCookie = 2
+		if len(w.pushed) != 1 {
+			t.Errorf("Push(%q) pushed %v, want 1 target", value, w.pushed)
 		}
 
-		cookies := res.Cookies()
-		if got, want := len(cookies), wantCookie; got != want {
-			t.Fatalf("Number of cookie %d, want %d", got, want)
+		want, _ := casper.GenerateCookie([]string{"/static/example.js"})
+		if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].Value != want.Value {
+			t.Errorf("Push(%q) set %v, want %s", value, cookies, want.Value)
+		}
+	}
+}
+
+func TestReadCookie_Header(t *testing.T) {
+	casper := New(1<<6, 4)
+
+	cases := []struct {
+		value string
+		want  []uint
+	}{
+		// Same parameters
+		{cookieValue(casper, "gU4"), []uint{65, 104}},
+
+		// Without header (previous format)
+		{"gU4", nil},
+
+		// Unknown version
+		{"AkABQCQ", nil},
+
+		// Different p. It can not be converted.
+		{cookieValue(New(1<<5, 4), "gU4"), nil},
+
+		// Hash range is 2 times larger (n=8). It can be converted.
+		// 10000001 0100111 11110000000 => {65, 104, 360}
+		{cookieValue(New(1<<6, 8), "gU_gAA"), []uint{65, 104}},
+	}
+
+	for _, tc := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.AddCookie(&http.Cookie{
+			Name:  defaultCookieName,
+			Value: tc.value,
+		})
+
+		fingerprint, err := casper.readCookie(req)
+		if err != nil {
+			t.Fatalf("readCookie(%q) should not fail: %s", tc.value, err)
 		}
 
-		tc.casperCookie.Raw = tc.casperCookie.String() // Need to set Raw to compare
-		if got, want := cookies[wantCookie-1], tc.casperCookie; !reflect.DeepEqual(got, want) {
-			t.Fatalf("Get cookie name %#v, want %#v", got, want)
+		if got := fingerprint.Values(); len(got) != len(tc.want) || (len(got) != 0 && !reflect.DeepEqual(got, tc.want)) {
+			t.Errorf("readCookie(%q)=%v, want=%v", tc.value, got, tc.want)
 		}
 	}
 }
 
+func FuzzReadCookie(f *testing.F) {
+	casper := New(1<<6, 10)
+
+	f.Add(cookieValue(casper, "JA"))
+	f.Add(cookieValue(casper, "gU4"))
+	f.Add(cookieValue(casper, "gU54MA"))
+	f.Add(cookieValue(New(1<<6, 20), "FmDhUxQHeuwQYINoQrxmr1g_iw"))
+	f.Add("gU4")
+	f.Fuzz(func(t *testing.T, value string) {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set("Cookie", defaultCookieName+"="+value)
+
+		fingerprint, err := casper.readCookie(req)
+		if err != nil {
+			return
+		}
+
+		values := fingerprint.Values()
+		if len(values) > int(casper.n)*maxEntriesFactor {
+			t.Fatalf("decoded %d entries", len(values))
+		}
+
+		for i, v := range values {
+			if v >= casper.n*casper.p {
+				t.Fatalf("decoded value %d is out of range", v)
+			}
+
+			if i > 0 && v <= values[i-1] {
+				t.Fatalf("decoded values are not increasing: %v", values)
+			}
+		}
+
+		if _, err := casper.generateCookie(fingerprint); err != nil {
+			t.Fatalf("generateCookie should not fail: %s", err)
+		}
+	})
+}
+
 func TestPush_ServerPushNotSupported(t *testing.T) {
 	var err error
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -361,56 +362,75 @@ func TestPush_ServerPushNotSupported(t *testing.T) {
 	}
 }
 
-func newTestServer(t *testing.T, casper *Casper, contents []string, sameTime bool, cookie *http.Cookie) *httptest.Server {
-	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+func TestInspectCookie(t *testing.T) {
+	c := New(1<<6, 10)
 
-		// Set additinal cookie if provided.
-		if cookie != nil {
-			http.SetCookie(w, cookie)
-		}
+	fingerprint := gcs.New(c.m)
+	fingerprint.Add(c.hashTarget("/static/example.js"))
+	cookie, err := c.generateCookie(fingerprint)
+	if err != nil {
+		t.Fatalf("generateCookie should not fail: %s", err)
+	}
 
-		if sameTime {
-			// Push all contents at same time
-			if _, err := casper.Push(w, r, contents, nil); err != nil {
-				t.Fatalf("Push failed: %s", err)
-			}
-		} else {
-			// Push contents one by one. Test for context.
-			for _, content := range contents {
-				var err error
-				r, err = casper.Push(w, r, []string{content}, nil)
-				if err != nil {
-					t.Fatalf("Push failed: %s", err)
-				}
-			}
-		}
+	f, err := c.InspectCookie(cookie.Value)
+	if err != nil {
+		t.Fatalf("InspectCookie should not fail: %s", err)
+	}
 
-		w.Header().Add("Content-Type", "text/html")
-		w.Write([]byte(""))
-		w.WriteHeader(http.StatusOK)
-	}))
+	if f.Version != fingerprintVersion || f.P != c.p || f.N != c.n || f.M != c.m {
+		t.Fatalf("unexpected header: %d p=%d n=%d m=%d", f.Version, f.P, f.N, f.M)
+	}
 
-	if err := http2.ConfigureServer(ts.Config, nil); err != nil {
-		t.Fatalf("Failed to configure h2 server: %s", err)
+	if !reflect.DeepEqual(f.Values, fingerprint.Values()) {
+		t.Fatalf("Values=%v, want=%v", f.Values, fingerprint.Values())
 	}
-	ts.TLS = ts.Config.TLSConfig
-	ts.StartTLS()
 
-	return ts
-}
+	if !f.Contains("/static/example.js") {
+		t.Fatalf("fingerprint should contain /static/example.js")
+	}
 
-func newTestH2Client(t *testing.T) *http.Client {
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
+	if got, want := f.FalsePositiveRate(), 1.0/640; got != want {
+		t.Fatalf("FalsePositiveRate=%f, want=%f", got, want)
 	}
 
-	if err := http2.ConfigureTransport(tr); err != nil {
-		t.Fatalf("Failed to configure h2 transport: %s", err)
+	// Value without header is decoded with the casper parameters.
+	body, _ := fingerprint.MarshalBinary()
+	f, err = c.InspectCookie(base64.RawURLEncoding.EncodeToString(body))
+	if err != nil {
+		t.Fatalf("InspectCookie should not fail: %s", err)
 	}
 
-	return &http.Client{
-		Transport: tr,
+	if f.Version != 0 || !f.Contains("/static/example.js") {
+		t.Fatalf("legacy value should be decoded: version %d, values %v", f.Version, f.Values)
+	}
+}
+
+func TestGenerateCookie_Targets(t *testing.T) {
+	cases := []struct {
+		n       int
+		targets []string
+	}{
+		{10, []string{"/static/example.js", "/static/example.css"}},
+
+		// More targets than the capacity.
+		{2, []string{"/a.js", "/b.js", "/c.js", "/d.js", "/e.js", "/f.js"}},
+	}
+
+	for _, tc := range cases {
+		c := New(1<<6, tc.n)
+
+		w := newPushRecorder()
+		if _, err := c.Push(w, httptest.NewRequest("GET", "/", nil), tc.targets, nil); err != nil {
+			t.Fatalf("Push should not fail: %s", err)
+		}
+
+		cookie, err := c.GenerateCookie(tc.targets)
+		if err != nil {
+			t.Fatalf("GenerateCookie should not fail: %s", err)
+		}
+
+		if got, want := cookie.String(), w.Header().Get("Set-Cookie"); got != want {
+			t.Fatalf("GenerateCookie(%v)=%q, want=%q", tc.targets, got, want)
+		}
 	}
 }
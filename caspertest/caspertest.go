@@ -0,0 +1,139 @@
+/*
+Package caspertest provides utilities for testing handlers which use
+casper.
+
+ResponseRecorder records the server pushes, so handlers can be tested
+without HTTP/2 connections:
+
+	func TestHandler(t *testing.T) {
+		rec := caspertest.NewRecorder()
+		handler.ServeHTTP(rec, caspertest.NewRequest("GET", "/", pusher, "/static/app.css"))
+
+		caspertest.AssertPushed(t, rec, "/static/app.js")
+		caspertest.AssertNotPushed(t, rec, "/static/app.css")
+	}
+*/
+package caspertest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	casper "github.com/tcnksm/go-casper"
+)
+
+// Push is a server push recorded by ResponseRecorder.
+type Push struct {
+	// Target is the pushed target.
+	Target string
+
+	// Options is the options of the push.
+	Options *http.PushOptions
+}
+
+// ResponseRecorder is an implementation of http.ResponseWriter and
+// http.Pusher which records the response and the pushes.
+type ResponseRecorder struct {
+	*httptest.ResponseRecorder
+
+	// Pushes are the pushes in the order of the calls.
+	Pushes []Push
+
+	// PushErr is returned by Push if set. The push is not
+	// recorded then. It's used to test the push failure.
+	PushErr error
+}
+
+// NewRecorder returns an initialized ResponseRecorder.
+func NewRecorder() *ResponseRecorder {
+	return &ResponseRecorder{
+		ResponseRecorder: httptest.NewRecorder(),
+	}
+}
+
+// Push implements http.Pusher.
+func (rw *ResponseRecorder) Push(target string, opts *http.PushOptions) error {
+	if rw.PushErr != nil {
+		return rw.PushErr
+	}
+
+	rw.Pushes = append(rw.Pushes, Push{
+		Target:  target,
+		Options: opts,
+	})
+	return nil
+}
+
+// Pushed returns the pushed targets in the order of the pushes.
+func (rw *ResponseRecorder) Pushed() []string {
+	targets := make([]string, 0, len(rw.Pushes))
+	for _, p := range rw.Pushes {
+		targets = append(targets, p.Target)
+	}
+	return targets
+}
+
+// NewRequest returns a new incoming server request like
+// httptest.NewRequest. The request carries the fingerprint
+// cookie of c in which the given targets are cached.
+func NewRequest(method, target string, c *casper.Casper, cached ...string) *http.Request {
+	req := httptest.NewRequest(method, target, nil)
+
+	cookie, err := c.GenerateCookie(cached)
+	if err != nil {
+		panic("caspertest: " + err.Error())
+	}
+	req.AddCookie(cookie)
+	return req
+}
+
+// NextRequest returns a new incoming server request like
+// httptest.NewRequest. The request carries the cookies set by
+// the previous response as a browser does.
+func NextRequest(method, target string, prev *ResponseRecorder) *http.Request {
+	req := httptest.NewRequest(method, target, nil)
+	for _, cookie := range prev.Result().Cookies() {
+		req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	return req
+}
+
+// AssertPushed fails the test if any of the targets is not pushed.
+func AssertPushed(t testing.TB, rw *ResponseRecorder, targets ...string) {
+	t.Helper()
+	for _, target := range targets {
+		if !rw.pushed(target) {
+			t.Errorf("%s is not pushed (pushed %s)", target, rw.pushedString())
+		}
+	}
+}
+
+// AssertNotPushed fails the test if any of the targets is pushed.
+// If no target is given, it fails if anything is pushed.
+func AssertNotPushed(t testing.TB, rw *ResponseRecorder, targets ...string) {
+	t.Helper()
+	if len(targets) == 0 && len(rw.Pushes) != 0 {
+		t.Errorf("nothing should be pushed (pushed %s)", rw.pushedString())
+	}
+
+	for _, target := range targets {
+		if rw.pushed(target) {
+			t.Errorf("%s should not be pushed", target)
+		}
+	}
+}
+
+func (rw *ResponseRecorder) pushed(target string) bool {
+	for _, p := range rw.Pushes {
+		if p.Target == target {
+			return true
+		}
+	}
+	return false
+}
+
+func (rw *ResponseRecorder) pushedString() string {
+	return fmt.Sprintf("%v", rw.Pushed())
+}
@@ -0,0 +1,67 @@
+package caspertest
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	casper "github.com/tcnksm/go-casper"
+)
+
+func TestResponseRecorder(t *testing.T) {
+	rec := NewRecorder()
+
+	var _ http.Pusher = rec
+
+	opts := &http.PushOptions{Method: "GET"}
+	rec.Push("/static/app.js", opts)
+	rec.Push("/static/app.css", nil)
+
+	want := []Push{
+		{Target: "/static/app.js", Options: opts},
+		{Target: "/static/app.css"},
+	}
+	if !reflect.DeepEqual(rec.Pushes, want) {
+		t.Fatalf("Pushes=%v, want=%v", rec.Pushes, want)
+	}
+
+	if got, want := rec.Pushed(), []string{"/static/app.js", "/static/app.css"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Pushed=%v, want=%v", got, want)
+	}
+
+	AssertPushed(t, rec, "/static/app.js", "/static/app.css")
+	AssertNotPushed(t, rec, "/static/logo.jpg")
+
+	rec.PushErr = errors.New("push failed")
+	if err := rec.Push("/static/logo.jpg", nil); err != rec.PushErr {
+		t.Fatalf("Push should return PushErr: %v", err)
+	}
+
+	if got := len(rec.Pushes); got != 2 {
+		t.Fatalf("failed push should not be recorded")
+	}
+}
+
+func TestNewRequest(t *testing.T) {
+	pusher := casper.New(1<<6, 10)
+
+	rec := NewRecorder()
+	req := NewRequest("GET", "/", pusher, "/static/app.js")
+	if _, err := pusher.Push(rec, req, []string{"/static/app.js", "/static/app.css"}, nil); err != nil {
+		t.Fatalf("Push should not fail: %s", err)
+	}
+
+	if got, want := rec.Pushed(), []string{"/static/app.css"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Pushed=%v, want=%v", got, want)
+	}
+
+	next := NewRecorder()
+	if _, err := pusher.Push(next, NextRequest("GET", "/", rec), []string{"/static/app.js", "/static/app.css"}, nil); err != nil {
+		t.Fatalf("Push should not fail: %s", err)
+	}
+
+	if len(next.Pushes) != 0 {
+		t.Fatalf("nothing should be pushed: %v", next.Pushed())
+	}
+}
@@ -0,0 +1,395 @@
+package caspertest
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// NewServer starts and returns a new HTTP/2 server over TLS with
+// the given handler. The caller should call Close when finished.
+func NewServer(handler http.Handler) *httptest.Server {
+	ts := httptest.NewUnstartedServer(handler)
+	if err := http2.ConfigureServer(ts.Config, nil); err != nil {
+		panic("caspertest: failed to configure h2 server: " + err.Error())
+	}
+	ts.TLS = ts.Config.TLSConfig
+	ts.StartTLS()
+	return ts
+}
+
+// ClientOptions includes options for Client.
+type ClientOptions struct {
+	// DisablePush disables server push by SETTINGS_ENABLE_PUSH.
+	DisablePush bool
+
+	// Timeout is the time limit for each request. If zero,
+	// 10 seconds is used.
+	Timeout time.Duration
+
+	// H2C connects to the server by HTTP/2 over cleartext TCP
+	// with prior knowledge instead of TLS.
+	H2C bool
+
+	// MaxConcurrentStreams limits the number of concurrent streams
+	// the server can open (i.e., pushes) by SETTINGS_MAX_CONCURRENT_STREAMS.
+	// If zero, it's not limited.
+	MaxConcurrentStreams uint32
+}
+
+// Client is a HTTP/2 client which receives server pushes. Unlike
+// http.Client, it exposes PUSH_PROMISE frames and the pushed responses.
+// It keeps cookies like a browser does.
+//
+// It sends requests one by one on a single connection, and it's not
+// safe for concurrent use.
+type Client struct {
+	url     *url.URL
+	conn    net.Conn
+	framer  *http2.Framer
+	timeout time.Duration
+
+	hbuf bytes.Buffer
+	henc *hpack.Encoder
+	hdec *hpack.Decoder
+
+	jar          http.CookieJar
+	nextStreamID uint32
+}
+
+// Response is a HTTP/2 response with the pushed responses.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+
+	// Pushes are the pushed responses in the order of
+	// the PUSH_PROMISE frames.
+	Pushes []*PushedResponse
+}
+
+// PushedResponse is a response pushed by the server.
+type PushedResponse struct {
+	// Method and Path are the method and the path of
+	// the promised request.
+	Method string
+	Path   string
+
+	// PromiseHeader is the header of the promised request.
+	PromiseHeader http.Header
+
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+
+	// Reset reports whether the push is cancelled
+	// by RST_STREAM.
+	Reset bool
+}
+
+// Pushed returns the paths of the pushed responses.
+func (r *Response) Pushed() []string {
+	paths := make([]string, 0, len(r.Pushes))
+	for _, p := range r.Pushes {
+		paths = append(paths, p.Path)
+	}
+	return paths
+}
+
+// NewClient connects to the HTTP/2 server started by NewServer. With
+// ClientOptions.H2C, it connects to the server started by ts.Start.
+func NewClient(ts *httptest.Server, opts *ClientOptions) (*Client, error) {
+	if opts == nil {
+		opts = &ClientOptions{}
+	}
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := dial(u.Host, opts.H2C)
+	if err != nil {
+		return nil, err
+	}
+
+	jar, _ := cookiejar.New(nil)
+	c := &Client{
+		url:          u,
+		conn:         conn,
+		framer:       http2.NewFramer(conn, conn),
+		timeout:      opts.Timeout,
+		hdec:         hpack.NewDecoder(4096, nil),
+		jar:          jar,
+		nextStreamID: 1,
+	}
+	c.henc = hpack.NewEncoder(&c.hbuf)
+	c.framer.ReadMetaHeaders = c.hdec
+
+	if c.timeout == 0 {
+		c.timeout = 10 * time.Second
+	}
+
+	enablePush := uint32(1)
+	if opts.DisablePush {
+		enablePush = 0
+	}
+
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	if _, err := conn.Write([]byte(http2.ClientPreface)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	settings := []http2.Setting{{ID: http2.SettingEnablePush, Val: enablePush}}
+	if opts.MaxConcurrentStreams != 0 {
+		settings = append(settings, http2.Setting{ID: http2.SettingMaxConcurrentStreams, Val: opts.MaxConcurrentStreams})
+	}
+
+	if err := c.framer.WriteSettings(settings...); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// dial connects to the server and negotiates h2 when TLS is used.
+func dial(addr string, h2c bool) (net.Conn, error) {
+	if h2c {
+		return net.Dial("tcp", addr)
+	}
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{http2.NextProtoTLS},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if p := conn.ConnectionState().NegotiatedProtocol; p != http2.NextProtoTLS {
+		conn.Close()
+		return nil, fmt.Errorf("server does not support h2 (negotiated %q)", p)
+	}
+	return conn, nil
+}
+
+// Jar returns the cookie jar of the client.
+func (c *Client) Jar() http.CookieJar {
+	return c.jar
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Get issues a GET request to the path.
+func (c *Client) Get(path string) (*Response, error) {
+	return c.Do("GET", path, nil)
+}
+
+// clientStream is a stream opened by a request or a push.
+type clientStream struct {
+	status int
+	header http.Header
+	body   bytes.Buffer
+	done   bool
+
+	// push is nil for the request stream.
+	push *PushedResponse
+}
+
+// Do sends the request without body and waits for the response and
+// all pushed responses.
+func (c *Client) Do(method, path string, header http.Header) (*Response, error) {
+	ref, err := url.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	u := c.url.ResolveReference(ref)
+
+	streamID := c.nextStreamID
+	c.nextStreamID += 2
+
+	c.hbuf.Reset()
+	c.writeField(":method", method)
+	c.writeField(":scheme", c.url.Scheme)
+	c.writeField(":authority", c.url.Host)
+	c.writeField(":path", u.RequestURI())
+	for k, vs := range header {
+		for _, v := range vs {
+			c.writeField(strings.ToLower(k), v)
+		}
+	}
+
+	if cookies := c.jar.Cookies(u); len(cookies) != 0 {
+		s := make([]string, 0, len(cookies))
+		for _, cookie := range cookies {
+			s = append(s, cookie.Name+"="+cookie.Value)
+		}
+		c.writeField("cookie", strings.Join(s, "; "))
+	}
+
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	if err := c.framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      streamID,
+		BlockFragment: c.hbuf.Bytes(),
+		EndStream:     true,
+		EndHeaders:    true,
+	}); err != nil {
+		return nil, err
+	}
+
+	res := &Response{}
+	main := &clientStream{header: make(http.Header)}
+	streams := map[uint32]*clientStream{streamID: main}
+	open := 1
+
+	end := func(s *clientStream) {
+		if !s.done {
+			s.done = true
+			open--
+		}
+	}
+
+	for open > 0 {
+		f, err := c.framer.ReadFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch f := f.(type) {
+		case *http2.SettingsFrame:
+			if !f.IsAck() {
+				if err := c.framer.WriteSettingsAck(); err != nil {
+					return nil, err
+				}
+			}
+
+		case *http2.PingFrame:
+			if !f.IsAck() {
+				if err := c.framer.WritePing(true, f.Data); err != nil {
+					return nil, err
+				}
+			}
+
+		case *http2.GoAwayFrame:
+			return nil, fmt.Errorf("received GOAWAY: %s", f.ErrCode)
+
+		case *http2.MetaHeadersFrame:
+			s, ok := streams[f.StreamID]
+			if !ok {
+				return nil, fmt.Errorf("received HEADERS on unknown stream %d", f.StreamID)
+			}
+
+			if status := f.PseudoValue("status"); status != "" {
+				s.status, _ = strconv.Atoi(status)
+			}
+
+			for _, hf := range f.RegularFields() {
+				s.header.Add(http.CanonicalHeaderKey(hf.Name), hf.Value)
+			}
+
+			if f.StreamEnded() {
+				end(s)
+			}
+
+		case *http2.PushPromiseFrame:
+			if !f.HeadersEnded() {
+				return nil, errors.New("CONTINUATION of PUSH_PROMISE is not supported")
+			}
+
+			fields, err := c.hdec.DecodeFull(f.HeaderBlockFragment())
+			if err != nil {
+				return nil, err
+			}
+
+			push := &PushedResponse{PromiseHeader: make(http.Header)}
+			for _, hf := range fields {
+				switch hf.Name {
+				case ":method":
+					push.Method = hf.Value
+				case ":path":
+					push.Path = hf.Value
+				default:
+					if !strings.HasPrefix(hf.Name, ":") {
+						push.PromiseHeader.Add(http.CanonicalHeaderKey(hf.Name), hf.Value)
+					}
+				}
+			}
+
+			streams[f.PromiseID] = &clientStream{header: make(http.Header), push: push}
+			res.Pushes = append(res.Pushes, push)
+			open++
+
+		case *http2.DataFrame:
+			s, ok := streams[f.StreamID]
+			if !ok {
+				return nil, fmt.Errorf("received DATA on unknown stream %d", f.StreamID)
+			}
+			s.body.Write(f.Data())
+
+			// Keep the flow control windows open.
+			if n := uint32(len(f.Data())); n > 0 {
+				if err := c.framer.WriteWindowUpdate(0, n); err != nil {
+					return nil, err
+				}
+
+				if !f.StreamEnded() {
+					if err := c.framer.WriteWindowUpdate(f.StreamID, n); err != nil {
+						return nil, err
+					}
+				}
+			}
+
+			if f.StreamEnded() {
+				end(s)
+			}
+
+		case *http2.RSTStreamFrame:
+			s, ok := streams[f.StreamID]
+			if !ok {
+				continue
+			}
+
+			if s.push == nil {
+				return nil, fmt.Errorf("request is reset: %s", f.ErrCode)
+			}
+			s.push.Reset = true
+			end(s)
+		}
+	}
+
+	res.StatusCode = main.status
+	res.Header = main.header
+	res.Body = main.body.Bytes()
+	c.jar.SetCookies(u, (&http.Response{Header: res.Header}).Cookies())
+
+	for _, s := range streams {
+		if s.push != nil {
+			s.push.StatusCode = s.status
+			s.push.Header = s.header
+			s.push.Body = s.body.Bytes()
+		}
+	}
+
+	return res, nil
+}
+
+func (c *Client) writeField(name, value string) {
+	c.henc.WriteField(hpack.HeaderField{Name: name, Value: value})
+}
@@ -0,0 +1,195 @@
+package casper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Asset is a static file in the catalog.
+type Asset struct {
+	// Path is the URL path of the asset (e.g., "/static/app.js").
+	Path string
+
+	// Name is the name of the file in the file system.
+	Name string
+
+	// Size is the size of the file in bytes.
+	Size int64
+
+	// ModTime is the modification time of the file.
+	ModTime time.Time
+
+	// Hash is the hex encoded SHA-256 hash of the file content.
+	Hash string
+
+	// ETag is the strong entity tag of the file.
+	ETag string
+
+	// HashedPath is the URL path of the asset with the content hash
+	// (e.g., "/static/app.3f9a0c2e.js"). Since it's changed when the
+	// content is changed, it can be cached by the client forever.
+	HashedPath string
+}
+
+// Catalog is a set of static files (assets) with their content hashes.
+// It's built once from a file system and used to validate push targets
+// and to version fingerprint entries by the file content.
+//
+// An asset can be referred by both its path and its hashed path.
+type Catalog struct {
+	fsys   fs.FS
+	prefix string
+
+	assets map[string]*Asset
+	hashed map[string]*Asset
+	paths  []string
+}
+
+// NewCatalog walks the given file system and returns a catalog of all
+// files in it. prefix is the URL path prefix of the assets (e.g.,
+// "/static/"). If empty, "/" is used.
+//
+// It can be used with embed.FS. Use fs.Sub to remove the directory
+// name of the embedded files from their paths:
+//
+//	//go:embed static
+//	var static embed.FS
+//
+//	fsys, _ := fs.Sub(static, "static")
+//	catalog, err := casper.NewCatalog(fsys, "/static/")
+func NewCatalog(fsys fs.FS, prefix string) (*Catalog, error) {
+	prefix = cleanPrefix(prefix)
+
+	c := &Catalog{
+		fsys:   fsys,
+		prefix: prefix,
+		assets: make(map[string]*Asset),
+		hashed: make(map[string]*Asset),
+	}
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		asset, err := newAsset(fsys, name)
+		if err != nil {
+			return err
+		}
+		asset.Path = prefix + name
+		asset.HashedPath = hashedPath(asset.Path, asset.Hash)
+
+		c.assets[asset.Path] = asset
+		c.hashed[asset.HashedPath] = asset
+		c.paths = append(c.paths, asset.Path)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk file system: %s", err)
+	}
+	sort.Strings(c.paths)
+
+	return c, nil
+}
+
+func newAsset(fsys fs.FS, name string) (*Asset, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+
+	return &Asset{
+		Name:    name,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Hash:    hash,
+		ETag:    `"` + hash[:32] + `"`,
+	}, nil
+}
+
+// Lookup returns the asset of the given URL path or hashed path.
+func (c *Catalog) Lookup(urlPath string) (*Asset, bool) {
+	if asset, ok := c.assets[urlPath]; ok {
+		return asset, true
+	}
+	asset, ok := c.hashed[urlPath]
+	return asset, ok
+}
+
+// URL returns the hashed path of the given target. It returns the
+// target as it is if it's not in the catalog. It can be used as
+// a template function to refer the assets:
+//
+//	template.FuncMap{"asset": catalog.URL}
+func (c *Catalog) URL(target string) string {
+	asset, ok := c.Lookup(target)
+	if !ok {
+		return target
+	}
+	return asset.HashedPath
+}
+
+// Assets returns all assets in the catalog sorted by the path.
+func (c *Catalog) Assets() []*Asset {
+	assets := make([]*Asset, 0, len(c.paths))
+	for _, p := range c.paths {
+		assets = append(assets, c.assets[p])
+	}
+	return assets
+}
+
+// Validate returns an error if any of the given targets is not
+// in the catalog.
+func (c *Catalog) Validate(targets []string) error {
+	var unknown []string
+	for _, target := range targets {
+		if _, ok := c.Lookup(target); !ok {
+			unknown = append(unknown, target)
+		}
+	}
+
+	if len(unknown) != 0 {
+		return fmt.Errorf("unknown assets: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// hashedPath inserts the short content hash before the extension
+// of the path.
+func hashedPath(p, hash string) string {
+	dir, base := path.Split(p)
+	ext := path.Ext(base)
+	return dir + strings.TrimSuffix(base, ext) + "." + hash[:8] + ext
+}
+
+// cleanPrefix returns the prefix which starts and ends with "/".
+func cleanPrefix(prefix string) string {
+	prefix = path.Clean("/" + prefix)
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return prefix
+}
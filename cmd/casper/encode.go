@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+)
+
+const encodeUsage = `Usage: casper encode [options] [assets...]
+
+Generate the fingerprint cookie which the browser holds after the
+given assets are pushed. It's identical to the cookie set by the
+server with the same parameters. The assets can also be given by
+-assets, -assets-file or -manifest.
+
+It prints the cookie value and the Cookie header.
+
+Options:
+`
+
+func runEncode(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("encode", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, encodeUsage)
+		flags.PrintDefaults()
+	}
+
+	var (
+		cf casperFlags
+		tf targetFlags
+	)
+	cf.register(flags)
+	tf.register(flags)
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	c, err := cf.casper()
+	if err != nil {
+		fmt.Fprintf(stderr, "invalid parameters: %s\n", err)
+		return 1
+	}
+
+	targets, err := tf.targets()
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to load assets: %s\n", err)
+		return 1
+	}
+	targets = append(targets, flags.Args()...)
+
+	cookie, err := c.GenerateCookie(targets)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to generate cookie: %s\n", err)
+		return 1
+	}
+
+	fmt.Fprintln(stdout, cookie.Value)
+	fmt.Fprintf(stdout, "Cookie: %s=%s\n", cookie.Name, cookie.Value)
+	return 0
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	casper "github.com/tcnksm/go-casper"
+)
+
+// casperFlags are the flags to configure the casper.
+type casperFlags struct {
+	p, n, m    int
+	cookieName string
+	static     string
+	prefix     string
+}
+
+func (f *casperFlags) register(flags *flag.FlagSet) {
+	flags.IntVar(&f.p, "p", 1<<6, "inverse of false positive probability")
+	flags.IntVar(&f.n, "n", 10, "number of contents tracked by the fingerprint")
+	flags.IntVar(&f.m, "m", 0, "golomb parameter (default p)")
+	flags.StringVar(&f.cookieName, "cookie-name", "", "name of the fingerprint cookie (default \"x-go-casper\")")
+	flags.StringVar(&f.static, "static", "", "directory of static files to version assets by content hash")
+	flags.StringVar(&f.prefix, "prefix", "/static/", "URL path prefix of the static files")
+}
+
+// casper returns the casper configured by the flags.
+func (f *casperFlags) casper() (*casper.Casper, error) {
+	config := &casper.Config{
+		P:          f.p,
+		N:          f.n,
+		M:          f.m,
+		CookieName: f.cookieName,
+	}
+
+	if f.static != "" {
+		catalog, err := casper.NewCatalog(os.DirFS(f.static), f.prefix)
+		if err != nil {
+			return nil, err
+		}
+		config.Catalog = catalog
+	}
+
+	return casper.NewWithConfig(config)
+}
+
+// targetFlags are the flags to specify the assets.
+type targetFlags struct {
+	assets     string
+	assetsFile string
+	manifest   string
+	format     string
+	entry      string
+}
+
+func (f *targetFlags) register(flags *flag.FlagSet) {
+	flags.StringVar(&f.assets, "assets", "", "comma separated list of assets")
+	flags.StringVar(&f.assetsFile, "assets-file", "", "file which lists assets (one per line)")
+	flags.StringVar(&f.manifest, "manifest", "", "bundler manifest file")
+	flags.StringVar(&f.format, "format", "vite", "format of the manifest (webpack, vite or esbuild)")
+	flags.StringVar(&f.entry, "entry", "", "entry point in the manifest (default all entries)")
+}
+
+// targets loads the assets specified by the flags.
+func (f *targetFlags) targets() ([]string, error) {
+	var targets []string
+	if f.assets != "" {
+		targets = append(targets, strings.Split(f.assets, ",")...)
+	}
+
+	if f.assetsFile != "" {
+		list, err := readList(f.assetsFile)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, list...)
+	}
+
+	if f.manifest != "" {
+		list, err := readManifest(f.manifest, f.format, f.entry)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, list...)
+	}
+
+	return targets, nil
+}
+
+// readList reads the file which lists assets one per line.
+// Empty lines and lines starting with "#" are ignored.
+func readList(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var list []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		list = append(list, line)
+	}
+	return list, s.Err()
+}
+
+// readManifest reads the assets of the entry in the bundler manifest.
+// If entry is empty, the assets of all entries are returned.
+func readManifest(name, format, entry string) ([]string, error) {
+	manifest, err := loadManifest(name, format)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []string{entry}
+	if entry == "" {
+		entries = manifest.Entries()
+	}
+
+	var list []string
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		assets, err := manifest.EntryAssets(e)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, asset := range assets {
+			if !seen[asset] {
+				seen[asset] = true
+				list = append(list, asset)
+			}
+		}
+	}
+	return list, nil
+}
+
+// loadManifest loads the bundler manifest of the given format.
+func loadManifest(name, format string) (*casper.Manifest, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch format {
+	case "webpack":
+		return casper.LoadWebpackManifest(f, nil)
+	case "vite":
+		return casper.LoadViteManifest(f, nil)
+	case "esbuild":
+		return casper.LoadEsbuildMetafile(f, nil)
+	default:
+		return nil, fmt.Errorf("unknown manifest format %q", format)
+	}
+}
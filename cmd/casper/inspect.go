@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const inspectUsage = `Usage: casper inspect [options] <cookie value>
+
+Decode the fingerprint cookie value and print the hash values in it.
+The value can be given with the cookie name ("x-go-casper=...").
+With -assets or -manifest, it shows which assets the fingerprint
+claims are cached.
+
+Options:
+`
+
+func runInspect(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, inspectUsage)
+		flags.PrintDefaults()
+	}
+
+	var (
+		cf casperFlags
+		tf targetFlags
+	)
+	cf.register(flags)
+	tf.register(flags)
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	value := flags.Arg(0)
+	if i := strings.Index(value, "="); i >= 0 {
+		value = value[i+1:]
+	}
+
+	c, err := cf.casper()
+	if err != nil {
+		fmt.Fprintf(stderr, "invalid parameters: %s\n", err)
+		return 1
+	}
+
+	f, err := c.InspectCookie(value)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to decode cookie: %s\n", err)
+		return 1
+	}
+
+	if f.Version == 0 {
+		fmt.Fprintf(stdout, "version:    none (decoded with p=%d n=%d m=%d)\n", f.P, f.N, f.M)
+	} else {
+		fmt.Fprintf(stdout, "version:    %d\n", f.Version)
+		fmt.Fprintf(stdout, "parameters: p=%d n=%d m=%d\n", f.P, f.N, f.M)
+	}
+	fmt.Fprintf(stdout, "values:     %v\n", f.Values)
+	fmt.Fprintf(stdout, "entries:    %d (estimated %.1f)\n", len(f.Values), f.EstimatedEntries())
+	fmt.Fprintf(stdout, "false positive probability: %.4f\n", f.FalsePositiveRate())
+
+	targets, err := tf.targets()
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to load assets: %s\n", err)
+		return 1
+	}
+
+	if len(targets) != 0 {
+		fmt.Fprintln(stdout)
+	}
+	for _, target := range targets {
+		state := "not cached"
+		if f.Contains(target) {
+			state = "cached"
+		}
+		fmt.Fprintf(stdout, "%-10s  %s\n", state, target)
+	}
+
+	return 0
+}
@@ -0,0 +1,68 @@
+// Command casper is a tool for debugging go-casper.
+//
+// Usage:
+//
+//	casper <command> [options] [arguments]
+//
+// The commands are:
+//
+//	inspect    decode and inspect a fingerprint cookie value
+//	encode     generate a fingerprint cookie for assets
+//	size       estimate the cookie size and the false positive rate
+//	simulate   replay browsing sessions and report the pushes
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `Usage: casper <command> [options] [arguments]
+
+Commands:
+  inspect    decode and inspect a fingerprint cookie value
+  encode     generate a fingerprint cookie for assets
+  size       estimate the cookie size and the false positive rate
+  simulate   replay browsing sessions and report the pushes
+
+Run "casper <command> -h" for the options of the command.
+`
+
+// command is a subcommand of casper.
+type command struct {
+	name string
+	run  func(args []string, stdout, stderr io.Writer) int
+}
+
+var commands = []command{
+	{"inspect", runInspect},
+	{"encode", runEncode},
+	{"size", runSize},
+	{"simulate", runSimulate},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:], stdout, stderr)
+		}
+	}
+
+	if args[0] == "-h" || args[0] == "help" {
+		fmt.Fprint(stdout, usage)
+		return 0
+	}
+
+	fmt.Fprintf(stderr, "unknown command %q\n\n%s", args[0], usage)
+	return 2
+}
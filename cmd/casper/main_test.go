@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	cases := []struct {
+		args []string
+		code int
+	}{
+		{nil, 2},
+		{[]string{"help"}, 0},
+		{[]string{"unknown"}, 2},
+		{[]string{"inspect"}, 2},
+		{[]string{"inspect", "-p", "0", "AUAKQMkA"}, 1},
+		{[]string{"inspect", "!!!"}, 1},
+	}
+
+	for _, tc := range cases {
+		var stdout, stderr bytes.Buffer
+		if got := run(tc.args, &stdout, &stderr); got != tc.code {
+			t.Errorf("run(%v) returns %d, want %d: %s", tc.args, got, tc.code, stderr.String())
+		}
+	}
+}
+
+func TestInspect(t *testing.T) {
+	dir := t.TempDir()
+	list := filepath.Join(dir, "assets.txt")
+	if err := os.WriteFile(list, []byte("# assets\n/static/example.js\n\n/static/example.css\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"inspect", "-assets-file", list, "x-go-casper=AUAKQMkA"}
+	if code := run(args, &stdout, &stderr); code != 0 {
+		t.Fatalf("run(%v) returns %d: %s", args, code, stderr.String())
+	}
+
+	for _, want := range []string{
+		"version:    1\n",
+		"parameters: p=64 n=10 m=64\n",
+		"entries:    1 (estimated 1.0)\n",
+		"cached      /static/example.js\n",
+		"not cached  /static/example.css\n",
+	} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("output should contain %q:\n%s", want, stdout.String())
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	args := []string{"encode", "/static/example.js"}
+	if code := run(args, &stdout, &stderr); code != 0 {
+		t.Fatalf("run(%v) returns %d: %s", args, code, stderr.String())
+	}
+
+	if got, want := stdout.String(), "AUAKQMkA\nCookie: x-go-casper=AUAKQMkA\n"; got != want {
+		t.Fatalf("output %q, want %q", got, want)
+	}
+
+	// Round trip.
+	stdout.Reset()
+	args = []string{"inspect", "-assets", "/static/example.js", "AUAKQMkA"}
+	if code := run(args, &stdout, &stderr); code != 0 {
+		t.Fatalf("run(%v) returns %d: %s", args, code, stderr.String())
+	}
+
+	if !strings.Contains(stdout.String(), "cached      /static/example.js\n") {
+		t.Fatalf("encoded asset should be cached:\n%s", stdout.String())
+	}
+}
+
+func TestSize(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	args := []string{"size", "-assets", "10,20", "-fp", "0.01", "-n", "20", "-runs", "5", "-probes", "10"}
+	if code := run(args, &stdout, &stderr); code != 0 {
+		t.Fatalf("run(%v) returns %d: %s", args, code, stderr.String())
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if got, want := len(lines), 3; got != want {
+		t.Fatalf("number of lines %d, want %d:\n%s", got, want, stdout.String())
+	}
+
+	if fields := strings.Fields(lines[1]); fields[0] != "10" || fields[1] != "100" || fields[2] != "20" {
+		t.Fatalf("unexpected row: %q", lines[1])
+	}
+
+	for _, args := range [][]string{
+		{"size", "-assets", "0"},
+		{"size", "-p", "x"},
+		{"size", "-fp", "2"},
+	} {
+		if code := run(args, &stdout, &stderr); code != 2 {
+			t.Errorf("run(%v) returns %d, want 2", args, code)
+		}
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	dir := t.TempDir()
+	sessions := filepath.Join(dir, "sessions.jsonl")
+	input := `{"session": "a", "page": "/", "assets": ["/static/app.js"]}
+{"session": "a", "page": "/about", "assets": ["/static/app.js", "/static/about.jpg"]}
+`
+	if err := os.WriteFile(sessions, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"simulate", "-sessions", sessions, "-p", "64,128", "-n", "10"}
+	if code := run(args, &stdout, &stderr); code != 0 {
+		t.Fatalf("run(%v) returns %d: %s", args, code, stderr.String())
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if got, want := len(lines), 3; got != want {
+		t.Fatalf("number of lines %d, want %d:\n%s", got, want, stdout.String())
+	}
+
+	// p, n, policy, page views, pushes, wasted, missed, budget skips, ...
+	if got, want := strings.Fields(lines[1])[:8], []string{"64", "10", "stale", "2", "2", "0", "0", "0"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("row %v, want %v", got, want)
+	}
+
+	// The budget allows only one push for each page view.
+	budget := filepath.Join(dir, "budget.jsonl")
+	input = `{"session": "a", "page": "/", "assets": ["/static/app.js", "/static/app.css"]}
+`
+	if err := os.WriteFile(budget, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout.Reset()
+	args = []string{"simulate", "-sessions", budget, "-policy", "stale,generation", "-max-pushes", "1"}
+	if code := run(args, &stdout, &stderr); code != 0 {
+		t.Fatalf("run(%v) returns %d: %s", args, code, stderr.String())
+	}
+
+	lines = strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if got, want := len(lines), 3; got != want {
+		t.Fatalf("number of lines %d, want %d:\n%s", got, want, stdout.String())
+	}
+
+	for i, policy := range []string{"stale", "generation"} {
+		if got, want := strings.Fields(lines[i+1])[2:8], []string{policy, "1", "1", "0", "0", "1"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("row %v, want %v", got, want)
+		}
+	}
+
+	if code := run([]string{"simulate", "-sessions", sessions, "-policy", "lru"}, &stdout, &stderr); code != 2 {
+		t.Fatalf("simulate with unknown policy should fail")
+	}
+
+	if code := run([]string{"simulate"}, &stdout, &stderr); code != 2 {
+		t.Fatalf("simulate without sessions should fail")
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	casper "github.com/tcnksm/go-casper"
+	"github.com/tcnksm/go-casper/simulate"
+)
+
+const simulateUsage = `Usage: casper simulate [options]
+
+Replay browsing sessions against casper with each combination of the
+candidate parameters and eviction policies and report the pushes.
+Sessions are read from JSON lines (-sessions) or generated from the
+entries of the bundler manifest (-manifest), where each entry is a page.
+
+The targets which the browser did not have but were not pushed are
+reported as missed (by the fingerprint), budget skips (by -max-pushes)
+and connection skips (already pushed on the connection, -single-conn).
+
+Example:
+
+  casper simulate -manifest manifest.json -p 64,128 -n 10,20 -policy stale,random
+
+Options:
+`
+
+func runSimulate(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, simulateUsage)
+		flags.PrintDefaults()
+	}
+
+	var (
+		ps, ns, policies string
+		static, prefix   string
+		sessionsFile     string
+		manifest, format string
+		sessions         int
+		minViews         int
+		maxViews         int
+		cacheSize        int64
+		evict            float64
+		maxPushes        int
+		singleConn       bool
+		seed             int64
+	)
+	flags.StringVar(&ps, "p", "64", "comma separated candidates of p")
+	flags.StringVar(&ns, "n", "10", "comma separated candidates of n")
+	flags.StringVar(&policies, "policy", "stale", "comma separated candidates of the eviction policy (stale, random or generation)")
+	flags.StringVar(&static, "static", "", "directory of static files for the asset sizes and content hashes")
+	flags.StringVar(&prefix, "prefix", "/static/", "URL path prefix of the static files")
+	flags.StringVar(&sessionsFile, "sessions", "", "JSON lines file of recorded page views")
+	flags.StringVar(&manifest, "manifest", "", "bundler manifest file for synthetic sessions")
+	flags.StringVar(&format, "format", "vite", "format of the manifest (webpack, vite or esbuild)")
+	flags.IntVar(&sessions, "synthetic-sessions", 1000, "number of synthetic sessions")
+	flags.IntVar(&minViews, "min-views", 1, "minimum number of page views in a synthetic session")
+	flags.IntVar(&maxViews, "max-views", 10, "maximum number of page views in a synthetic session")
+	flags.Int64Var(&cacheSize, "cache-size", 0, "capacity of the browser cache in bytes (default unlimited)")
+	flags.Float64Var(&evict, "evict", 0, "probability that each cached asset is evicted before a page view")
+	flags.IntVar(&maxPushes, "max-pushes", 0, "maximum number of targets pushed for a page view (default unlimited)")
+	flags.BoolVar(&singleConn, "single-conn", false, "serve each session on a single connection")
+	flags.Int64Var(&seed, "seed", 1, "random seed")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if (sessionsFile == "") == (manifest == "") {
+		fmt.Fprintln(stderr, "either -sessions or -manifest must be given")
+		return 2
+	}
+
+	pCandidates, err := parseInts(ps)
+	if err != nil {
+		fmt.Fprintf(stderr, "invalid -p: %s\n", err)
+		return 2
+	}
+
+	nCandidates, err := parseInts(ns)
+	if err != nil {
+		fmt.Fprintf(stderr, "invalid -n: %s\n", err)
+		return 2
+	}
+
+	policyCandidates, err := parsePolicies(policies)
+	if err != nil {
+		fmt.Fprintf(stderr, "invalid -policy: %s\n", err)
+		return 2
+	}
+
+	if maxPushes < 0 {
+		fmt.Fprintln(stderr, "invalid -max-pushes: must not be negative")
+		return 2
+	}
+
+	var catalog *casper.Catalog
+	sizes := make(map[string]int64)
+	if static != "" {
+		catalog, err = casper.NewCatalog(os.DirFS(static), prefix)
+		if err != nil {
+			fmt.Fprintf(stderr, "failed to load static files: %s\n", err)
+			return 1
+		}
+
+		for _, asset := range catalog.Assets() {
+			sizes[asset.Path] = asset.Size
+			sizes[asset.HashedPath] = asset.Size
+		}
+	}
+
+	var ss []simulate.Session
+	if sessionsFile != "" {
+		ss, err = readSessions(sessionsFile)
+	} else {
+		ss, err = syntheticSessions(manifest, format, &simulate.Synthetic{
+			Sessions: sessions,
+			MinViews: minViews,
+			MaxViews: maxViews,
+			Seed:     seed,
+		})
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to load sessions: %s\n", err)
+		return 1
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "p\tn\tpolicy\tpage views\tpushes\twasted\tmissed\tbudget skips\tconn skips\tbytes pushed\twasted bytes\t")
+	for _, p := range pCandidates {
+		for _, n := range nCandidates {
+			for _, policy := range policyCandidates {
+				c, err := casper.NewWithConfig(&casper.Config{
+					P:         p,
+					N:         n,
+					Catalog:   catalog,
+					Eviction:  policy.policy,
+					MaxPushes: maxPushes,
+				})
+				if err != nil {
+					fmt.Fprintf(stderr, "invalid parameters: %s\n", err)
+					return 1
+				}
+
+				r, err := simulate.Run(&simulate.Config{
+					Casper:           c,
+					Sizes:            sizes,
+					CacheSize:        cacheSize,
+					EvictProbability: evict,
+					SingleConnection: singleConn,
+					Seed:             seed,
+				}, ss)
+				if err != nil {
+					fmt.Fprintf(stderr, "failed to simulate: %s\n", err)
+					return 1
+				}
+
+				fmt.Fprintf(tw, "%d\t%d\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t\n",
+					p, n, policy.name, r.PageViews, r.Pushes, r.WastedPushes, r.MissedPushes,
+					r.BudgetSkips, r.ConnectionSkips, r.BytesPushed, r.WastedBytes)
+			}
+		}
+	}
+	tw.Flush()
+
+	return 0
+}
+
+func readSessions(name string) ([]simulate.Session, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return simulate.ReadSessions(f)
+}
+
+// evictionPolicy is an eviction policy with its name in -policy.
+type evictionPolicy struct {
+	name   string
+	policy casper.EvictionPolicy
+}
+
+// parsePolicies parses the comma separated names of the eviction policies.
+func parsePolicies(s string) ([]evictionPolicy, error) {
+	var policies []evictionPolicy
+	for _, f := range strings.Split(s, ",") {
+		name := strings.TrimSpace(f)
+		switch name {
+		case "stale":
+			policies = append(policies, evictionPolicy{name, casper.EvictStale})
+		case "random":
+			policies = append(policies, evictionPolicy{name, casper.EvictRandom})
+		case "generation":
+			policies = append(policies, evictionPolicy{name, casper.EvictGeneration})
+		default:
+			return nil, fmt.Errorf("unknown eviction policy %q", name)
+		}
+	}
+	return policies, nil
+}
+
+// syntheticSessions generates sessions whose pages are the entries
+// of the manifest.
+func syntheticSessions(manifest, format string, s *simulate.Synthetic) ([]simulate.Session, error) {
+	m, err := loadManifest(manifest, format)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range m.Entries() {
+		assets, err := m.EntryAssets(entry)
+		if err != nil {
+			return nil, err
+		}
+
+		s.Pages = append(s.Pages, simulate.PageView{
+			Page:   "/" + entry,
+			Assets: assets,
+		})
+	}
+
+	return s.Generate()
+}
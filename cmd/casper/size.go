@@ -0,0 +1,208 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	casper "github.com/tcnksm/go-casper"
+)
+
+const sizeUsage = `Usage: casper size [options]
+
+Estimate the cookie size and the false positive rate for the given
+number of assets and the candidate parameters. Each combination is
+measured by encoding fingerprints of random assets and by checking
+random assets which are not in them.
+
+Example:
+
+  casper size -assets 80 -p 64,128 -n 80,100
+
+Options:
+`
+
+func runSize(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("size", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, sizeUsage)
+		flags.PrintDefaults()
+	}
+
+	var (
+		assets, ps, ns string
+		fp             float64
+		runs, probes   int
+		seed           int64
+	)
+	flags.StringVar(&assets, "assets", "10", "comma separated numbers of assets")
+	flags.StringVar(&ps, "p", "", "comma separated candidates of p (default derived from -fp)")
+	flags.StringVar(&ns, "n", "", "comma separated candidates of n (default the number of assets)")
+	flags.Float64Var(&fp, "fp", 0.01, "target false positive probability used when -p is not given")
+	flags.IntVar(&runs, "runs", 200, "number of random fingerprints for each combination")
+	flags.IntVar(&probes, "probes", 1000, "number of random assets checked against each fingerprint")
+	flags.Int64Var(&seed, "seed", 1, "random seed")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if runs <= 0 || probes <= 0 {
+		fmt.Fprintln(stderr, "-runs and -probes must be positive")
+		return 2
+	}
+
+	assetCounts, err := parseInts(assets)
+	if err != nil {
+		fmt.Fprintf(stderr, "invalid -assets: %s\n", err)
+		return 2
+	}
+
+	pCandidates, err := parseInts(ps)
+	if err != nil {
+		fmt.Fprintf(stderr, "invalid -p: %s\n", err)
+		return 2
+	}
+	if len(pCandidates) == 0 {
+		if fp <= 0 || fp >= 1 {
+			fmt.Fprintln(stderr, "-fp must be between 0 and 1")
+			return 2
+		}
+		pCandidates = []int{int(1/fp + 0.5)}
+	}
+
+	nCandidates, err := parseInts(ns)
+	if err != nil {
+		fmt.Fprintf(stderr, "invalid -n: %s\n", err)
+		return 2
+	}
+
+	rnd := rand.New(rand.NewSource(seed))
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "assets\tp\tn\texpected size\tmax sampled size\tfp (theory)\tfp (measured)\t")
+	for _, k := range assetCounts {
+		nc := nCandidates
+		if len(nc) == 0 {
+			nc = []int{k}
+		}
+
+		for _, p := range pCandidates {
+			for _, n := range nc {
+				c, err := casper.NewWithConfig(&casper.Config{P: p, N: n})
+				if err != nil {
+					fmt.Fprintf(stderr, "invalid parameters: %s\n", err)
+					return 1
+				}
+
+				r, err := measure(c, k, runs, probes, rnd)
+				if err != nil {
+					fmt.Fprintf(stderr, "failed to measure: %s\n", err)
+					return 1
+				}
+
+				fmt.Fprintf(tw, "%d\t%d\t%d\t%.1f\t%d\t%.4f\t%.4f\t\n",
+					k, p, n, r.meanSize, r.maxSize, r.theoryFP, r.measuredFP)
+			}
+		}
+	}
+	tw.Flush()
+
+	return 0
+}
+
+// sizeResult is the result of the measurement.
+type sizeResult struct {
+	// meanSize and maxSize are the mean and the largest size of
+	// the Cookie header value (name=value) in bytes among the
+	// random fingerprints. maxSize is not a worst-case bound.
+	meanSize float64
+	maxSize  int
+
+	// theoryFP is the false positive rate estimated from
+	// the number of hash values in the fingerprint.
+	theoryFP float64
+
+	// measuredFP is the rate of the random assets which
+	// the fingerprint claims to be cached.
+	measuredFP float64
+}
+
+// measure generates runs random fingerprints with k assets and
+// checks probes random assets which are not in them.
+func measure(c *casper.Casper, k, runs, probes int, rnd *rand.Rand) (*sizeResult, error) {
+	var (
+		result            sizeResult
+		totalSize         int
+		totalFP           float64
+		positives, checks int
+	)
+
+	for i := 0; i < runs; i++ {
+		targets := make([]string, k)
+		for j := range targets {
+			targets[j] = randomAsset(rnd)
+		}
+
+		cookie, err := c.GenerateCookie(targets)
+		if err != nil {
+			return nil, err
+		}
+
+		size := len(cookie.Name) + 1 + len(cookie.Value)
+		totalSize += size
+		if size > result.maxSize {
+			result.maxSize = size
+		}
+
+		f, err := c.InspectCookie(cookie.Value)
+		if err != nil {
+			return nil, err
+		}
+		totalFP += f.FalsePositiveRate()
+
+		for j := 0; j < probes; j++ {
+			// Random assets have a different prefix so that
+			// they are never in the fingerprint.
+			if f.Contains("/probe" + randomAsset(rnd)) {
+				positives++
+			}
+			checks++
+		}
+	}
+
+	result.meanSize = float64(totalSize) / float64(runs)
+	result.theoryFP = totalFP / float64(runs)
+	result.measuredFP = float64(positives) / float64(checks)
+	return &result, nil
+}
+
+func randomAsset(rnd *rand.Rand) string {
+	return fmt.Sprintf("/static/%016x.js", rnd.Uint64())
+}
+
+// parseInts parses comma separated positive integers.
+func parseInts(s string) ([]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var ints []int
+	for _, f := range strings.Split(s, ",") {
+		i, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil {
+			return nil, err
+		}
+
+		if i <= 0 {
+			return nil, fmt.Errorf("%d is not positive", i)
+		}
+		ints = append(ints, i)
+	}
+	return ints, nil
+}
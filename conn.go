@@ -0,0 +1,132 @@
+package casper
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// connPushesContextKey is used for storing the targets pushed on
+// the connection in context.Value.
+var connPushesContextKey = &contextKey{"casper-conn-pushes"}
+
+// connPushes is the set of targets pushed on a connection with their
+// sizes. Requests on a HTTP/2 connection are handled concurrently, so
+// it's guarded by the mutex.
+type connPushes struct {
+	mu      sync.Mutex
+	targets map[string]int64
+	bytes   int64
+}
+
+func newConnPushes() *connPushes {
+	return &connPushes{targets: make(map[string]int64)}
+}
+
+// reserve adds the target if it's not pushed on the connection yet and
+// it fits the budget of the connection. maxCount and maxBytes are the
+// budget. Zero means no limit.
+func (p *connPushes) reserve(target string, size int64, maxCount int, maxBytes int64) PushStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.targets[target]; ok {
+		return PushStatusConnection
+	}
+
+	if (maxCount > 0 && len(p.targets)+1 > maxCount) || (maxBytes > 0 && p.bytes+size > maxBytes) {
+		return PushStatusBudget
+	}
+
+	p.targets[target] = size
+	p.bytes += size
+	return PushStatusPushed
+}
+
+// release removes the target which was not pushed.
+func (p *connPushes) release(target string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.bytes -= p.targets[target]
+	delete(p.targets, target)
+}
+
+// connRegistry maps the connections to their pushed targets,
+// so that they are released by ConnState.
+var connRegistry = struct {
+	sync.Mutex
+	conns map[net.Conn]*connPushes
+}{
+	conns: make(map[net.Conn]*connPushes),
+}
+
+// ConnContext is used as http.Server.ConnContext to deduplicate pushes on
+// each connection. Once a target is pushed on a connection, Push does not
+// push it again on the connection even when the client cookie does not
+// reflect it yet (e.g., parallel requests on a HTTP/2 connection). It's
+// shared by all caspers.
+//
+// ConnState must be also set to release the connection. ConfigureServer
+// sets both.
+func ConnContext(ctx context.Context, conn net.Conn) context.Context {
+	p := newConnPushes()
+
+	connRegistry.Lock()
+	connRegistry.conns[conn] = p
+	connRegistry.Unlock()
+
+	return context.WithValue(ctx, connPushesContextKey, p)
+}
+
+// ConnState is used as http.Server.ConnState with ConnContext. It releases
+// the targets pushed on the connection when it's closed.
+func ConnState(conn net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateClosed, http.StateHijacked:
+	default:
+		return
+	}
+
+	connRegistry.Lock()
+	p, ok := connRegistry.conns[conn]
+	delete(connRegistry.conns, conn)
+	connRegistry.Unlock()
+
+	// Hijacked connection may still be used (e.g., by h2c).
+	if ok && state == http.StateClosed {
+		p.mu.Lock()
+		p.targets = make(map[string]int64)
+		p.bytes = 0
+		p.mu.Unlock()
+	}
+}
+
+// contextConnPushes returns the targets pushed on the connection
+// of the request. It returns nil if ConnContext is not used.
+func contextConnPushes(ctx context.Context) *connPushes {
+	p, _ := ctx.Value(connPushesContextKey).(*connPushes)
+	return p
+}
+
+// registeredConnPushes returns the targets pushed on the connection
+// registered by ConnContext.
+func registeredConnPushes(conn net.Conn) *connPushes {
+	connRegistry.Lock()
+	defer connRegistry.Unlock()
+	return connRegistry.conns[conn]
+}
+
+// withConnPushes returns the handler which serves requests with the
+// given targets pushed on the connection. It's used for the connection
+// served by another server (e.g., h2c) whose requests don't have it.
+func withConnPushes(h http.Handler, p *connPushes) http.Handler {
+	if p == nil {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), connPushesContextKey, p)))
+	})
+}
@@ -0,0 +1,89 @@
+package casper
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestConnContext(t *testing.T) {
+	conn, other := net.Pipe()
+	defer conn.Close()
+	defer other.Close()
+
+	ctx := ConnContext(httptest.NewRequest("GET", "/", nil).Context(), conn)
+	c := New(1<<6, 10)
+	targets := []string{"/static/app.js", "/static/app.css"}
+
+	// Parallel requests without cookie on the same connection.
+	first := newPushRecorder()
+	if _, err := c.Push(first, httptest.NewRequest("GET", "/", nil).WithContext(ctx), targets[:1], nil); err != nil {
+		t.Fatalf("Push should not fail: %s", err)
+	}
+
+	second := newPushRecorder()
+	if _, err := c.Push(second, httptest.NewRequest("GET", "/iframe", nil).WithContext(ctx), targets, nil); err != nil {
+		t.Fatalf("Push should not fail: %s", err)
+	}
+
+	if got, want := second.pushed, targets[1:]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("pushed %v, want %v", got, want)
+	}
+
+	// The cookie includes the target pushed by the other request.
+	cookie, _ := c.GenerateCookie(targets)
+	if cookies := second.Result().Cookies(); len(cookies) != 1 || cookies[0].Value != cookie.Value {
+		t.Fatalf("cookies %v, want %s", cookies, cookie.Value)
+	}
+
+	// Another connection.
+	other2, _ := net.Pipe()
+	defer other2.Close()
+	third := newPushRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	if _, err := c.Push(third, req.WithContext(ConnContext(req.Context(), other2)), targets, nil); err != nil {
+		t.Fatalf("Push should not fail: %s", err)
+	}
+
+	if got, want := third.pushed, targets; !reflect.DeepEqual(got, want) {
+		t.Fatalf("pushed %v, want %v", got, want)
+	}
+
+	// Closed connection is released.
+	ConnState(conn, http.StateClosed)
+	ConnState(other2, http.StateClosed)
+	if p := registeredConnPushes(conn); p != nil {
+		t.Fatalf("closed connection should be released")
+	}
+
+	if p := contextConnPushes(ctx); len(p.targets) != 0 {
+		t.Fatalf("targets should be released: %v", p.targets)
+	}
+}
+
+func TestConnContext_PushFailed(t *testing.T) {
+	conn, other := net.Pipe()
+	defer conn.Close()
+	defer other.Close()
+	defer ConnState(conn, http.StateClosed)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req = req.WithContext(ConnContext(req.Context(), conn))
+	c := New(1<<6, 10)
+
+	// httptest.ResponseRecorder does not support push.
+	if _, err := c.Push(WrapResponseWriter(httptest.NewRecorder()), req, []string{"/static/app.js"}, nil); err == nil {
+		t.Fatalf("Push should fail")
+	}
+
+	rec := newPushRecorder()
+	if _, err := c.Push(rec, req, []string{"/static/app.js"}, nil); err != nil {
+		t.Fatalf("Push should not fail: %s", err)
+	}
+
+	if got, want := rec.pushed, []string{"/static/app.js"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("pushed %v, want %v", got, want)
+	}
+}
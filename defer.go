@@ -0,0 +1,187 @@
+package casper
+
+import (
+	"bufio"
+	"log"
+	"net"
+	"net/http"
+)
+
+// DeferPush returns a handler which defers pushes by the given handler
+// until the response status is known. Push called with the wrapped
+// ResponseWriter only queues the targets, and they are pushed when the
+// handler calls WriteHeader (or the first Write or Flush) if the status
+// is one of Config.PushStatuses (by default, 200 only).
+//
+// If nothing is pushed (e.g., the handler returns 404 or a redirect),
+// the fingerprint cookie is left unchanged.
+//
+// Conditional requests (with If-None-Match or If-Modified-Since) answered
+// by 304 never push, since the client has the page and very likely its
+// assets. With Config.RecordNotModified, the targets are added to the
+// fingerprint instead.
+//
+// Errors of the deferred pushes can't be returned to the handler, so
+// they are logged.
+func (c *Casper) DeferPush(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dw := &deferredWriter{
+			ResponseWriter: WrapResponseWriter(w),
+			casper:         c,
+		}
+		next.ServeHTTP(dw, r)
+
+		// The handler wrote nothing. The server sends 200.
+		dw.start(http.StatusOK)
+	})
+}
+
+// deferredPush is a call to Push which is deferred.
+type deferredPush struct {
+	r       *http.Request
+	targets []string
+	opts    *Options
+}
+
+// deferredWriter queues pushes until the response starts.
+type deferredWriter struct {
+	*ResponseWriter
+
+	casper  *Casper
+	queue   []deferredPush
+	started bool
+}
+
+// findDeferredWriter returns the deferredWriter of c in the Unwrap
+// chain of w if the response is not started yet.
+func findDeferredWriter(c *Casper, w http.ResponseWriter) (*deferredWriter, bool) {
+	for {
+		if dw, ok := w.(*deferredWriter); ok && dw.casper == c {
+			return dw, !dw.started
+		}
+
+		u, ok := w.(rwUnwrapper)
+		if !ok {
+			return nil, false
+		}
+		w = u.Unwrap()
+	}
+}
+
+func (w *deferredWriter) enqueue(r *http.Request, targets []string, opts *Options) {
+	w.queue = append(w.queue, deferredPush{r: r, targets: targets, opts: opts})
+}
+
+// start runs the queued pushes if the status allows them.
+func (w *deferredWriter) start(status int) {
+	if w.started {
+		return
+	}
+	w.started = true
+
+	// The client revalidated the page and has it. It's very likely
+	// that the client has its assets too.
+	if status == http.StatusNotModified && len(w.queue) != 0 && isConditional(w.queue[0].r) {
+		if w.casper.recordNotModified {
+			w.recordQueue()
+		}
+		w.queue = nil
+		return
+	}
+
+	if !w.casper.pushStatus(status) {
+		w.queue = nil
+		return
+	}
+
+	var r *http.Request
+	for _, p := range w.queue {
+		// Keep the fingerprint and the push budget
+		// of the previous pushes.
+		if r != nil {
+			ctx := p.r.Context()
+			if fingerprint := w.casper.contextFingerprint(r.Context()); fingerprint != nil {
+				ctx = w.casper.withFingerprint(ctx, fingerprint)
+			}
+			ctx = w.casper.withResults(ctx, w.casper.contextResults(r.Context()))
+			p.r = p.r.WithContext(ctx)
+		}
+
+		var err error
+		r, err = w.casper.Push(w.ResponseWriter, p.r, p.targets, p.opts)
+		if err == http.ErrNotSupported || err == errPushNotSupported {
+			// Server push is not available (e.g., HTTP/1.1). It's
+			// not a failure, the page is served without pushes.
+			break
+		}
+
+		if err != nil {
+			log.Printf("[WARN] casper: deferred push failed: %s", err)
+			break
+		}
+	}
+	w.queue = nil
+}
+
+// recordQueue adds the queued targets to the fingerprint
+// without pushing them.
+func (w *deferredWriter) recordQueue() {
+	var targets []string
+	for _, p := range w.queue {
+		targets = append(targets, p.targets...)
+	}
+
+	if err := w.casper.record(w.ResponseWriter, w.queue[0].r, targets...); err != nil {
+		log.Printf("[WARN] casper: failed to record targets: %s", err)
+	}
+}
+
+func (w *deferredWriter) WriteHeader(code int) {
+	// Informational responses (e.g., 103 Early Hints) are
+	// followed by the final response.
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	w.start(code)
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *deferredWriter) Write(b []byte) (int, error) {
+	w.start(http.StatusOK)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *deferredWriter) Flush() {
+	w.start(http.StatusOK)
+	w.ResponseWriter.Flush()
+}
+
+func (w *deferredWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	// No response is sent by the server.
+	w.started = true
+	w.queue = nil
+	return w.ResponseWriter.Hijack()
+}
+
+// isConditional reports whether r is a conditional request
+// which may be answered by 304.
+func isConditional(r *http.Request) bool {
+	return r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != ""
+}
+
+// pushStatus reports whether the deferred pushes run
+// for the response status.
+func (c *Casper) pushStatus(status int) bool {
+	if len(c.pushStatuses) == 0 {
+		return status == http.StatusOK
+	}
+
+	for _, s := range c.pushStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
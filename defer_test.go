@@ -0,0 +1,213 @@
+package casper
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestDeferPush(t *testing.T) {
+	targets := []string{"/static/app.js", "/static/app.css"}
+
+	cases := []struct {
+		statuses []int
+		handler  func(w http.ResponseWriter)
+		pushed   []string
+	}{
+		{
+			nil,
+			func(w http.ResponseWriter) { w.WriteHeader(http.StatusOK) },
+			targets,
+		},
+		{
+			nil,
+			func(w http.ResponseWriter) { w.Write([]byte("body")) },
+			targets,
+		},
+		{
+			nil,
+			func(w http.ResponseWriter) {},
+			targets,
+		},
+		{
+			nil,
+			func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusEarlyHints)
+				w.WriteHeader(http.StatusOK)
+			},
+			targets,
+		},
+		{
+			nil,
+			func(w http.ResponseWriter) { http.NotFound(w, nil) },
+			nil,
+		},
+		{
+			nil,
+			func(w http.ResponseWriter) {
+				w.Header().Set("Location", "/login")
+				w.WriteHeader(http.StatusFound)
+			},
+			nil,
+		},
+		{
+			[]int{http.StatusOK, http.StatusNotFound},
+			func(w http.ResponseWriter) { w.WriteHeader(http.StatusNotFound) },
+			targets,
+		},
+	}
+
+	for i, tc := range cases {
+		c, err := NewWithConfig(&Config{P: 1 << 6, N: 10, PushStatuses: tc.statuses})
+		if err != nil {
+			t.Fatalf("NewWithConfig should not fail: %s", err)
+		}
+
+		handler := c.DeferPush(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Push one by one.
+			for _, target := range targets {
+				var err error
+				r, err = c.Push(w, r, []string{target}, nil)
+				if err != nil {
+					t.Fatalf("Push should not fail: %s", err)
+				}
+			}
+			tc.handler(w)
+		}))
+
+		rec := newPushRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+		if !reflect.DeepEqual(rec.pushed, tc.pushed) {
+			t.Fatalf("#%d pushed %v, want %v", i, rec.pushed, tc.pushed)
+		}
+
+		// Result() does not include the header changed after 1xx.
+		cookies := (&http.Response{Header: rec.Header()}).Cookies()
+		if tc.pushed == nil {
+			if len(cookies) != 0 {
+				t.Fatalf("#%d fingerprint should not be changed: %v", i, cookies)
+			}
+			continue
+		}
+
+		cookie, err := c.GenerateCookie(targets)
+		if err != nil {
+			t.Fatalf("GenerateCookie should not fail: %s", err)
+		}
+
+		if len(cookies) != 1 || cookies[0].Value != cookie.Value {
+			t.Fatalf("#%d cookies %v, want %s", i, cookies, cookie.Value)
+		}
+	}
+}
+
+func TestDeferPush_Wrapped(t *testing.T) {
+	c := New(1<<6, 10)
+
+	// Middleware inside DeferPush wraps the writer.
+	handler := c.DeferPush(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w = &statusWriter{ResponseWriter: WrapResponseWriter(w)}
+		if _, err := c.Push(w, r, []string{"/static/app.js"}, nil); err != nil {
+			t.Fatalf("Push should not fail: %s", err)
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	rec := newPushRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+	if len(rec.pushed) != 0 {
+		t.Fatalf("nothing should be pushed: %v", rec.pushed)
+	}
+}
+
+func TestDeferPush_NotModified(t *testing.T) {
+	targets := []string{"/static/app.js", "/static/app.css"}
+
+	cases := []struct {
+		config      Config
+		conditional bool
+		pushed      []string
+		recorded    bool
+	}{
+		{Config{P: 1 << 6, N: 10}, true, nil, false},
+		{Config{P: 1 << 6, N: 10, RecordNotModified: true}, true, nil, true},
+
+		// 304 is allowed but conditional request is never pushed.
+		{Config{P: 1 << 6, N: 10, PushStatuses: []int{http.StatusOK, http.StatusNotModified}}, true, nil, false},
+
+		// Not conditional.
+		{Config{P: 1 << 6, N: 10, PushStatuses: []int{http.StatusNotModified}}, false, targets, true},
+	}
+
+	for i, tc := range cases {
+		c, err := NewWithConfig(&tc.config)
+		if err != nil {
+			t.Fatalf("NewWithConfig should not fail: %s", err)
+		}
+
+		handler := c.DeferPush(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, err := c.Push(w, r, targets, nil); err != nil {
+				t.Fatalf("Push should not fail: %s", err)
+			}
+			w.WriteHeader(http.StatusNotModified)
+		}))
+
+		req := httptest.NewRequest("GET", "/", nil)
+		if tc.conditional {
+			req.Header.Set("If-None-Match", `"v1"`)
+		}
+
+		rec := newPushRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if !reflect.DeepEqual(rec.pushed, tc.pushed) {
+			t.Fatalf("#%d pushed %v, want %v", i, rec.pushed, tc.pushed)
+		}
+
+		cookies := rec.Result().Cookies()
+		if got := len(cookies) == 1; got != tc.recorded {
+			t.Fatalf("#%d expect recorded %t, got %t: %v", i, tc.recorded, got, cookies)
+		}
+
+		if !tc.recorded {
+			continue
+		}
+
+		cookie, _ := c.GenerateCookie(targets)
+		if cookies[0].Value != cookie.Value {
+			t.Fatalf("#%d cookie %s, want %s", i, cookies[0].Value, cookie.Value)
+		}
+	}
+}
+
+func TestDeferPush_HTTP1(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	c := New(1<<6, 10)
+	ts := httptest.NewServer(c.DeferPush(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := c.Push(w, r, []string{"/static/app.js"}, nil); err != nil {
+			t.Errorf("Push should not fail: %s", err)
+		}
+		w.Write([]byte("<html></html>"))
+	})))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Get should not fail: %s", err)
+	}
+	res.Body.Close()
+
+	// Server push is not available for HTTP/1.1. It's not a warning.
+	if buf.Len() != 0 {
+		t.Fatalf("nothing should be logged: %s", buf.String())
+	}
+}
@@ -0,0 +1,143 @@
+package casper
+
+import (
+	"math/rand"
+	"net/http"
+
+	"github.com/tcnksm/go-casper/gcs"
+)
+
+// EvictionPolicy decides which fingerprint entries are evicted when the
+// fingerprint is full (it has more than Config.N entries). The entries of
+// the targets of the current request are not evicted unless the request
+// alone has more than N*2 targets.
+type EvictionPolicy int
+
+const (
+	// EvictStale evicts the entries which are not of the current
+	// assets (Config.Assets, Config.Manifest and Config.Catalog), e.g.,
+	// the assets of the previous deploys. If the fingerprint is still
+	// full, the rest are evicted as EvictGeneration does.
+	EvictStale EvictionPolicy = iota
+
+	// EvictRandom evicts random entries until the fingerprint
+	// is not full.
+	EvictRandom
+
+	// EvictGeneration evicts all entries except for the current
+	// request, i.e., the fingerprint starts a new generation.
+	EvictGeneration
+)
+
+// evict removes entries from the fingerprint until it has at most n
+// entries. current are the targets of the request in the fingerprint in
+// priority order. They are kept unless the fingerprint exceeds the limit
+// for decoding it (see limits), then the lowest priority ones are evicted.
+// It returns the evicted entries.
+func (c *Casper) evict(fingerprint *gcs.Set, current []PushResult) []PushResult {
+	if uint(fingerprint.Len()) <= c.n {
+		return nil
+	}
+
+	inCurrent := make(map[uint]bool, len(current))
+	for _, result := range current {
+		inCurrent[result.Hash] = true
+	}
+
+	// Copy the values since Remove modifies them.
+	candidates := make([]uint, 0, fingerprint.Len())
+	for _, h := range fingerprint.Values() {
+		if !inCurrent[h] {
+			candidates = append(candidates, h)
+		}
+	}
+
+	var evicted []PushResult
+	remove := func(values []uint) {
+		for _, h := range values {
+			fingerprint.Remove(h)
+			evicted = append(evicted, PushResult{
+				Target: c.known[h],
+				Status: PushStatusEvicted,
+				Hash:   h,
+			})
+		}
+	}
+
+	switch c.eviction {
+	case EvictStale:
+		var stale, rest []uint
+		for _, h := range candidates {
+			if _, ok := c.known[h]; ok {
+				rest = append(rest, h)
+			} else {
+				stale = append(stale, h)
+			}
+		}
+
+		remove(stale)
+		if uint(fingerprint.Len()) > c.n {
+			remove(rest)
+		}
+	case EvictRandom:
+		rand.Shuffle(len(candidates), func(i, j int) {
+			candidates[i], candidates[j] = candidates[j], candidates[i]
+		})
+
+		excess := fingerprint.Len() - int(c.n)
+		if excess > len(candidates) {
+			excess = len(candidates)
+		}
+		remove(candidates[:excess])
+	case EvictGeneration:
+		remove(candidates)
+	}
+
+	// The cookie must be decoded by readCookie.
+	maxLen := c.limits().MaxLen
+	for i := len(current) - 1; i >= 0 && fingerprint.Len() > maxLen; i-- {
+		if fingerprint.Remove(current[i].Hash) {
+			evicted = append(evicted, PushResult{
+				Target: current[i].Target,
+				Status: PushStatusEvicted,
+				Hash:   current[i].Hash,
+				Size:   current[i].Size,
+			})
+		}
+	}
+	return evicted
+}
+
+// reportEvicted calls the OnEvict hook with the evicted entries.
+func (c *Casper) reportEvicted(r *http.Request, evicted []PushResult) {
+	if c.onEvict != nil && len(evicted) != 0 {
+		c.onEvict(r, evicted)
+	}
+}
+
+// knownTargets returns the current assets by their hash values.
+func (c *Casper) knownTargets() map[uint]string {
+	known := make(map[uint]string)
+	add := func(target string) {
+		known[c.hashTarget(target)] = target
+	}
+
+	for _, target := range c.assets {
+		add(target)
+	}
+
+	if c.manifest != nil {
+		for _, assets := range c.manifest.entries {
+			for _, target := range assets {
+				add(target)
+			}
+		}
+	}
+
+	if c.catalog != nil {
+		for _, asset := range c.catalog.Assets() {
+			add(asset.Path)
+		}
+	}
+	return known
+}
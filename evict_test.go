@@ -0,0 +1,178 @@
+package casper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestPush_Eviction(t *testing.T) {
+	old := []string{"/static/app.v1.js", "/static/style.v1.css"}
+	assets := []string{"/static/app.v2.js", "/static/style.v2.css", "/static/img.jpg"}
+
+	cases := []struct {
+		eviction EvictionPolicy
+
+		// evicted is the number of evicted entries and
+		// stale reports whether all of them are stale.
+		evicted int
+		stale   bool
+	}{
+		{eviction: EvictStale, evicted: 2, stale: true},
+		{eviction: EvictRandom, evicted: 1},
+		{eviction: EvictGeneration, evicted: 2},
+	}
+
+	for i, tc := range cases {
+		c, err := NewWithConfig(&Config{P: 1 << 6, N: 4, Assets: assets, Eviction: tc.eviction})
+		if err != nil {
+			t.Fatalf("#%d NewWithConfig should not fail: %s", i, err)
+		}
+
+		// The client has the old assets and a part of the current ones.
+		cookie, _ := c.GenerateCookie(append(old, assets[:2]...))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.AddCookie(cookie)
+
+		w := newPushRecorder()
+		r, err := c.PushAssets(w, req, nil)
+		if err != nil {
+			t.Fatalf("#%d Push should not fail: %s", i, err)
+		}
+
+		if got, want := w.pushed, assets[2:]; !reflect.DeepEqual(got, want) {
+			t.Fatalf("#%d pushed %v, want %v", i, got, want)
+		}
+
+		var evicted []PushResult
+		for _, result := range c.Results(r) {
+			if result.Status == PushStatusEvicted {
+				evicted = append(evicted, result)
+			}
+		}
+
+		if len(evicted) != tc.evicted {
+			t.Fatalf("#%d evicted %v, want %d entries", i, evicted, tc.evicted)
+		}
+
+		if tc.stale {
+			var got []uint
+			for _, result := range evicted {
+				if result.Target != "" {
+					t.Fatalf("#%d evicted entry %v should be stale", i, result)
+				}
+				got = append(got, result.Hash)
+			}
+
+			want := []uint{c.hashTarget(old[0]), c.hashTarget(old[1])}
+			sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+			sort.Slice(want, func(i, j int) bool { return want[i] < want[j] })
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("#%d evicted %v, want %v", i, got, want)
+			}
+		}
+
+		// The fingerprint keeps the assets of the request.
+		fingerprint := c.contextFingerprint(r.Context())
+		if fingerprint.Len() > 4 {
+			t.Fatalf("#%d fingerprint has %d entries, want at most 4", i, fingerprint.Len())
+		}
+
+		for _, target := range assets {
+			if !fingerprint.Contains(c.hashTarget(target)) {
+				t.Fatalf("#%d fingerprint should contain %s", i, target)
+			}
+		}
+
+		cookies := (&http.Response{Header: w.Header()}).Cookies()
+		if len(cookies) != 1 {
+			t.Fatalf("#%d cookies %v, want 1 cookie", i, cookies)
+		}
+	}
+}
+
+func TestPush_EvictionNotFull(t *testing.T) {
+	c := New(1<<6, 10)
+	r, err := c.Push(newPushRecorder(), httptest.NewRequest("GET", "/", nil), []string{"/static/app.js", "/static/app.css"}, nil)
+	if err != nil {
+		t.Fatalf("Push should not fail: %s", err)
+	}
+
+	for _, result := range c.Results(r) {
+		if result.Status == PushStatusEvicted {
+			t.Fatalf("%v should not be evicted", result)
+		}
+	}
+}
+
+func TestPush_EvictionLimit(t *testing.T) {
+	c := New(1<<6, 2)
+	targets := []string{"/a.js", "/b.js", "/c.js", "/d.js", "/e.js", "/f.js"}
+
+	w := newPushRecorder()
+	r, err := c.Push(w, httptest.NewRequest("GET", "/", nil), targets, nil)
+	if err != nil {
+		t.Fatalf("Push should not fail: %s", err)
+	}
+
+	// The lowest priority targets are evicted to keep
+	// the cookie decodable.
+	var evicted []string
+	for _, result := range c.Results(r) {
+		if result.Status == PushStatusEvicted {
+			evicted = append(evicted, result.Target)
+		}
+	}
+
+	if want := []string{"/f.js", "/e.js"}; !reflect.DeepEqual(evicted, want) {
+		t.Fatalf("evicted %v, want %v", evicted, want)
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("cookies %v, want 1 cookie", cookies)
+	}
+
+	// The cookie is accepted by the next request.
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookies[0])
+	fingerprint, err := c.readCookie(req)
+	if err != nil {
+		t.Fatalf("readCookie should not fail: %s", err)
+	}
+
+	if got, want := fingerprint.Len(), 2*maxEntriesFactor; got != want {
+		t.Fatalf("fingerprint has %d entries, want %d", got, want)
+	}
+}
+
+func TestFileServer_OnEvict(t *testing.T) {
+	var evicted []PushResult
+	c, err := NewWithConfig(&Config{
+		P: 1 << 6,
+		N: 1,
+		OnEvict: func(r *http.Request, results []PushResult) {
+			evicted = append(evicted, results...)
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewWithConfig should not fail: %s", err)
+	}
+
+	srv, err := FileServer(testFS(), &FileServerOptions{Prefix: "/static/", Casper: c})
+	if err != nil {
+		t.Fatalf("FileServer should not fail: %s", err)
+	}
+
+	cookie, _ := c.GenerateCookie([]string{"/static/style.css"})
+	req := httptest.NewRequest("GET", "/static/app.js", nil)
+	req.AddCookie(cookie)
+	srv.ServeHTTP(httptest.NewRecorder(), req)
+
+	want := []PushResult{{Status: PushStatusEvicted, Hash: c.hashTarget("/static/style.css")}}
+	if !reflect.DeepEqual(evicted, want) {
+		t.Fatalf("evicted %v, want %v", evicted, want)
+	}
+}
@@ -0,0 +1,9 @@
+package casper
+
+// Export for testing in casper_test package.
+const (
+	DefaultCookieName = defaultCookieName
+	DefaultCookiePath = defaultCookiePath
+)
+
+var CookieValue = cookieValue
@@ -0,0 +1,160 @@
+package casper
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"path"
+)
+
+// FileServerOptions includes options for FileServer.
+type FileServerOptions struct {
+	// Prefix is the URL path prefix of the files (e.g., "/static/").
+	// It's part of the served URL paths and the pushed targets, so the
+	// handler must not be mounted under http.StripPrefix. The prefix is
+	// removed only for looking up the file in fs.FS. If empty, "/" is
+	// used.
+	Prefix string
+
+	// Casper records the served files in the client fingerprint, so
+	// they are not pushed once the client fetches them by itself. If
+	// nil, the served files are not recorded.
+	//
+	// To push the file again when it's changed, the casper needs the
+	// catalog of the files (Config.Catalog). Use NewAssetServer to
+	// share the catalog between them.
+	Casper *Casper
+}
+
+// AssetServer is a http.Handler which serves static files with
+// strong ETags and tracks them in the client fingerprint.
+type AssetServer struct {
+	catalog *Catalog
+	casper  *Casper
+}
+
+// FileServer returns a handler that serves HTTP requests with the contents
+// of the file system like http.FileServer. All files are read once to build
+// the catalog (see Catalog), so files added after that are not served.
+//
+// Files are served by both their paths and hashed paths (see
+// Asset.HashedPath). It does not serve directory listings.
+func FileServer(fsys fs.FS, opts *FileServerOptions) (*AssetServer, error) {
+	if opts == nil {
+		opts = &FileServerOptions{}
+	}
+
+	catalog, err := NewCatalog(fsys, opts.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	return NewAssetServer(catalog, opts.Casper), nil
+}
+
+// NewAssetServer returns a handler that serves the files in the catalog
+// like FileServer. The casper records the served files (see
+// FileServerOptions.Casper). It's usually configured with the same
+// catalog:
+//
+//	catalog, err := casper.NewCatalog(os.DirFS("./static"), "/static/")
+//	...
+//	pusher, err := casper.NewWithConfig(&casper.Config{P: 1 << 6, N: 10, Catalog: catalog})
+//	...
+//	srv := casper.NewAssetServer(catalog, pusher)
+func NewAssetServer(catalog *Catalog, c *Casper) *AssetServer {
+	return &AssetServer{
+		catalog: catalog,
+		casper:  c,
+	}
+}
+
+// Catalog returns the catalog of the served files.
+func (s *AssetServer) Catalog() *Catalog {
+	return s.catalog
+}
+
+// Push is like Casper.Push but it returns an error without pushing
+// anything if any of the targets is not served by the server.
+func (s *AssetServer) Push(w http.ResponseWriter, r *http.Request, targets []string, opts *Options) (*http.Request, error) {
+	if s.casper == nil {
+		return r, errors.New("casper is not configured")
+	}
+
+	if err := s.catalog.Validate(targets); err != nil {
+		return r, err
+	}
+	return s.casper.Push(w, r, targets, opts)
+}
+
+// ServeHTTP implements http.Handler.
+func (s *AssetServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	asset, ok := s.catalog.Lookup(path.Clean(r.URL.Path))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	content, err := s.open(asset)
+	if err != nil {
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if c, ok := content.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	// The client has this file (or will have it by this response).
+	if s.recordable(r) {
+		if err := s.casper.record(w, r, asset.Path); err != nil {
+			log.Printf("[WARN] casper: failed to record %s: %s", asset.Path, err)
+		}
+	}
+
+	// The hashed path is never changed, so it can be cached forever.
+	if r.URL.Path == asset.HashedPath {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	}
+
+	// ServeContent handles conditional requests by ETag.
+	w.Header().Set("ETag", asset.ETag)
+	http.ServeContent(w, r, asset.Name, asset.ModTime, content)
+}
+
+// recordable reports whether the served file is recorded in the
+// fingerprint of the request.
+//
+// Requests without the fingerprint cookie are not recorded. The cookie
+// set by them would include only the served file and overwrite the
+// fingerprint of the page, e.g., requests promised by server push don't
+// have the cookie.
+func (s *AssetServer) recordable(r *http.Request) bool {
+	if s.casper == nil || (r.Method != "GET" && r.Method != "HEAD") {
+		return false
+	}
+
+	_, err := r.Cookie(s.casper.cookieName)
+	return err == nil
+}
+
+// open opens the file of the asset. If the file does not implement
+// io.Seeker, it's read into memory.
+func (s *AssetServer) open(asset *Asset) (io.ReadSeeker, error) {
+	f, err := s.catalog.fsys.Open(asset.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if rs, ok := f.(io.ReadSeeker); ok {
+		return rs, nil
+	}
+	defer f.Close()
+
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(b), nil
+}
@@ -0,0 +1,305 @@
+package casper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"app.js":          {Data: []byte("console.log('casper');")},
+		"style.css":       {Data: []byte("body { margin: 0; }")},
+		"img/example.jpg": {Data: []byte("jpg")},
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	catalog, err := NewCatalog(testFS(), "static")
+	if err != nil {
+		t.Fatalf("NewCatalog should not fail: %s", err)
+	}
+
+	var paths []string
+	for _, asset := range catalog.Assets() {
+		paths = append(paths, asset.Path)
+	}
+
+	if want := []string{"/static/app.js", "/static/img/example.jpg", "/static/style.css"}; !reflect.DeepEqual(paths, want) {
+		t.Fatalf("Assets=%v, want=%v", paths, want)
+	}
+
+	asset, ok := catalog.Lookup("/static/app.js")
+	if !ok {
+		t.Fatalf("Lookup should find /static/app.js")
+	}
+
+	sum := sha256.Sum256([]byte("console.log('casper');"))
+	if got, want := asset.Hash, hex.EncodeToString(sum[:]); got != want {
+		t.Fatalf("Hash=%s, want=%s", got, want)
+	}
+
+	if got, want := asset.Size, int64(22); got != want {
+		t.Fatalf("Size=%d, want=%d", got, want)
+	}
+
+	if err := catalog.Validate([]string{"/static/app.js", "/static/style.css"}); err != nil {
+		t.Fatalf("Validate should not fail: %s", err)
+	}
+
+	if err := catalog.Validate([]string{"/static/app.js", "/static/missing.js"}); err == nil {
+		t.Fatalf("Validate should fail for unknown asset")
+	}
+}
+
+func TestFileServer(t *testing.T) {
+	pusher := New(1<<6, 10)
+	srv, err := FileServer(testFS(), &FileServerOptions{
+		Prefix: "/static/",
+		Casper: pusher,
+	})
+	if err != nil {
+		t.Fatalf("FileServer should not fail: %s", err)
+	}
+
+	// Fetch the asset without the fingerprint.
+	req := httptest.NewRequest("GET", "/static/app.js", nil)
+	res := httptest.NewRecorder()
+	srv.ServeHTTP(res, req)
+
+	if got, want := res.Code, http.StatusOK; got != want {
+		t.Fatalf("status code %d, want %d", got, want)
+	}
+
+	if got, want := res.Body.String(), "console.log('casper');"; got != want {
+		t.Fatalf("body %q, want %q", got, want)
+	}
+
+	etag := res.Header().Get("ETag")
+	if asset, _ := srv.Catalog().Lookup("/static/app.js"); etag != asset.ETag {
+		t.Fatalf("ETag %s, want %s", etag, asset.ETag)
+	}
+
+	// It does not overwrite the fingerprint of the page.
+	if cookies := res.Result().Cookies(); len(cookies) != 0 {
+		t.Fatalf("fingerprint should not be set without the cookie: %v", cookies)
+	}
+
+	// The page pushes style.css.
+	req = httptest.NewRequest("GET", "/", nil)
+	w := newPushRecorder()
+	if _, err := srv.Push(w, req, []string{"/static/style.css"}, nil); err != nil {
+		t.Fatalf("Push should not fail: %s", err)
+	}
+	cookies := w.Result().Cookies()
+
+	// Fetch the asset with the fingerprint.
+	req = httptest.NewRequest("GET", "/static/app.js", nil)
+	req.AddCookie(cookies[0])
+	res = httptest.NewRecorder()
+	srv.ServeHTTP(res, req)
+
+	cookies = res.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != defaultCookieName {
+		t.Fatalf("served asset should be recorded in the fingerprint: %v", cookies)
+	}
+
+	// Revalidate the asset.
+	req = httptest.NewRequest("GET", "/static/app.js", nil)
+	req.Header.Set("If-None-Match", etag)
+	req.AddCookie(cookies[0])
+	res = httptest.NewRecorder()
+	srv.ServeHTTP(res, req)
+
+	if got, want := res.Code, http.StatusNotModified; got != want {
+		t.Fatalf("status code %d, want %d", got, want)
+	}
+
+	// Already recorded.
+	if got := res.Result().Cookies(); len(got) != 0 {
+		t.Fatalf("fingerprint should not be changed: %v", got)
+	}
+
+	// Push from the page handler. Both are cached.
+	req = httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookies[0])
+	w = newPushRecorder()
+	if _, err := srv.Push(w, req, []string{"/static/app.js", "/static/style.css"}, nil); err != nil {
+		t.Fatalf("Push should not fail: %s", err)
+	}
+
+	if len(w.pushed) != 0 {
+		t.Fatalf("nothing should be pushed: %v", w.pushed)
+	}
+
+	// Unknown asset is not pushed.
+	w = newPushRecorder()
+	if _, err := srv.Push(w, req, []string{"/static/style.css", "/static/missing.js"}, nil); err == nil {
+		t.Fatalf("Push should fail for unknown asset")
+	}
+
+	if len(w.pushed) != 0 {
+		t.Fatalf("nothing should be pushed: %v", w.pushed)
+	}
+}
+
+func TestFileServer_NotFound(t *testing.T) {
+	srv, err := FileServer(testFS(), &FileServerOptions{
+		Prefix: "/static/",
+	})
+	if err != nil {
+		t.Fatalf("FileServer should not fail: %s", err)
+	}
+
+	for _, p := range []string{"/static/missing.js", "/static/img/", "/static/", "/app.js"} {
+		req := httptest.NewRequest("GET", p, nil)
+		res := httptest.NewRecorder()
+		srv.ServeHTTP(res, req)
+
+		if got, want := res.Code, http.StatusNotFound; got != want {
+			t.Errorf("GET %s returns status code %d, want %d", p, got, want)
+		}
+	}
+}
+
+func TestFileServer_ContentChanged(t *testing.T) {
+	hashTarget := func(fsys fstest.MapFS) uint {
+		catalog, err := NewCatalog(fsys, "/static/")
+		if err != nil {
+			t.Fatalf("NewCatalog should not fail: %s", err)
+		}
+
+		pusher, err := NewWithConfig(&Config{P: 1 << 6, N: 10, Catalog: catalog})
+		if err != nil {
+			t.Fatalf("NewWithConfig should not fail: %s", err)
+		}
+		return pusher.hashTarget("/static/app.js")
+	}
+
+	fsys := testFS()
+	before := hashTarget(fsys)
+
+	fsys["app.js"] = &fstest.MapFile{Data: []byte("console.log('changed');")}
+	if after := hashTarget(fsys); before == after {
+		t.Fatalf("hash value should be changed when the content is changed")
+	}
+}
+
+func TestFileServer_SharedCasper(t *testing.T) {
+	pusher := New(1<<6, 10)
+	before := pusher.hashTarget("/static/app.js")
+
+	if _, err := FileServer(testFS(), &FileServerOptions{Prefix: "/static/", Casper: pusher}); err != nil {
+		t.Fatalf("FileServer should not fail: %s", err)
+	}
+
+	// FileServer does not change the casper.
+	if after := pusher.hashTarget("/static/app.js"); before != after {
+		t.Fatalf("hash value should not be changed by FileServer")
+	}
+}
+
+func TestCatalog_HashedPath(t *testing.T) {
+	catalog, err := NewCatalog(testFS(), "/static/")
+	if err != nil {
+		t.Fatalf("NewCatalog should not fail: %s", err)
+	}
+
+	asset, _ := catalog.Lookup("/static/img/example.jpg")
+	want := "/static/img/example." + asset.Hash[:8] + ".jpg"
+	if got := catalog.URL("/static/img/example.jpg"); got != want {
+		t.Fatalf("URL=%s, want=%s", got, want)
+	}
+
+	if got, ok := catalog.Lookup(want); !ok || got != asset {
+		t.Fatalf("Lookup(%q) should return the asset", want)
+	}
+
+	if got, want := catalog.URL("/static/missing.js"), "/static/missing.js"; got != want {
+		t.Fatalf("URL=%s, want=%s", got, want)
+	}
+
+	pusher, err := NewWithConfig(&Config{P: 1 << 6, N: 10, Catalog: catalog})
+	if err != nil {
+		t.Fatalf("NewWithConfig should not fail: %s", err)
+	}
+
+	if pusher.hashTarget(want) != pusher.hashTarget("/static/img/example.jpg") {
+		t.Fatalf("path and hashed path should have the same hash value")
+	}
+}
+
+func TestFileServer_HashedPath(t *testing.T) {
+	srv, err := FileServer(testFS(), &FileServerOptions{
+		Prefix: "/static/",
+	})
+	if err != nil {
+		t.Fatalf("FileServer should not fail: %s", err)
+	}
+
+	hashed := srv.Catalog().URL("/static/style.css")
+	req := httptest.NewRequest("GET", hashed, nil)
+	res := httptest.NewRecorder()
+	srv.ServeHTTP(res, req)
+
+	if got, want := res.Code, http.StatusOK; got != want {
+		t.Fatalf("status code %d, want %d", got, want)
+	}
+
+	if got, want := res.Header().Get("Cache-Control"), "public, max-age=31536000, immutable"; got != want {
+		t.Fatalf("Cache-Control %q, want %q", got, want)
+	}
+
+	// Not hashed path.
+	req = httptest.NewRequest("GET", "/static/style.css", nil)
+	res = httptest.NewRecorder()
+	srv.ServeHTTP(res, req)
+
+	if got := res.Header().Get("Cache-Control"); got != "" {
+		t.Fatalf("Cache-Control should not be set: %q", got)
+	}
+}
+
+func TestPush_UnknownTargets(t *testing.T) {
+	catalog, err := NewCatalog(testFS(), "/static/")
+	if err != nil {
+		t.Fatalf("NewCatalog should not fail: %s", err)
+	}
+
+	targets := []string{"/static/app.js", "/static/missing.js"}
+	cases := []struct {
+		policy  UnknownTargetPolicy
+		success bool
+		pushed  []string
+	}{
+		{UnknownTargetIgnore, true, targets},
+		{UnknownTargetWarn, true, targets},
+		{UnknownTargetError, false, nil},
+	}
+
+	for _, tc := range cases {
+		pusher, err := NewWithConfig(&Config{
+			P:              1 << 6,
+			N:              10,
+			Catalog:        catalog,
+			UnknownTargets: tc.policy,
+		})
+		if err != nil {
+			t.Fatalf("NewWithConfig should not fail: %s", err)
+		}
+
+		w := newPushRecorder()
+		_, err = pusher.Push(w, httptest.NewRequest("GET", "/", nil), targets, nil)
+		if got := err == nil; got != tc.success {
+			t.Fatalf("policy %d: expect %t, got %t: %v", tc.policy, tc.success, got, err)
+		}
+
+		if !reflect.DeepEqual(w.pushed, tc.pushed) {
+			t.Fatalf("policy %d: pushed %v, want %v", tc.policy, w.pushed, tc.pushed)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package casper
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"math"
+
+	"github.com/tcnksm/go-casper/gcs"
+)
+
+// fingerprintVersion is the version of the fingerprint format. It must be
+// incremented when the format or the hash function is changed so that old
+// cookies are not misinterpreted.
+const fingerprintVersion = 1
+
+// fingerprintHeader is the header of the encoded fingerprint. The encoded
+// fingerprint is the header followed by the golomb-coded hash values.
+//
+//	+---------+------------+------------+------------+----------------
+//	| version | p (varint) | n (varint) | m (varint) | golomb-coded ...
+//	+---------+------------+------------+------------+----------------
+//
+// With the header, the fingerprint can be decoded without knowing
+// the configuration which generated it.
+type fingerprintHeader struct {
+	version byte
+	p, n, m uint
+}
+
+// appendTo appends the encoded header to dst.
+func (h fingerprintHeader) appendTo(dst []byte) []byte {
+	dst = append(dst, h.version)
+	dst = binary.AppendUvarint(dst, uint64(h.p))
+	dst = binary.AppendUvarint(dst, uint64(h.n))
+	dst = binary.AppendUvarint(dst, uint64(h.m))
+	return dst
+}
+
+// parseFingerprintHeader parses the header from b and returns the rest
+// of b. It returns false if b does not start with the valid header.
+func parseFingerprintHeader(b []byte) (fingerprintHeader, []byte, bool) {
+	var h fingerprintHeader
+	if len(b) == 0 {
+		return h, nil, false
+	}
+	h.version, b = b[0], b[1:]
+
+	for _, v := range []*uint{&h.p, &h.n, &h.m} {
+		x, n := binary.Uvarint(b)
+		if n <= 0 || x == 0 || uint64(uint(x)) != x {
+			return h, nil, false
+		}
+		*v, b = uint(x), b[n:]
+	}
+
+	// Hash values must not overflow.
+	if h.n > ^uint(0)/h.p {
+		return h, nil, false
+	}
+
+	return h, b, true
+}
+
+// header returns the fingerprint header of the casper configuration.
+func (c *Casper) header() fingerprintHeader {
+	return fingerprintHeader{
+		version: fingerprintVersion,
+		p:       c.p,
+		n:       c.n,
+		m:       c.m,
+	}
+}
+
+// encodeFingerprint encodes the fingerprint with the header
+// and returns it as a cookie value.
+func (c *Casper) encodeFingerprint(fingerprint *gcs.Set) (string, error) {
+	body, err := fingerprint.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+
+	b := c.header().appendTo(make([]byte, 0, 16+len(body)))
+	b = append(b, body...)
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// decodeFingerprint decodes the cookie value to the fingerprint.
+//
+// If the value is generated by different version (including the value
+// without the header) or different parameters, it does not misinterpret
+// it. It migrates the fingerprint when the hash values can be converted
+// to the current parameters, otherwise it returns the empty fingerprint.
+//
+// It returns *gcs.DecodeError when the value is malformed or too large.
+func (c *Casper) decodeFingerprint(value string) (*gcs.Set, error) {
+	body, h, err := c.decodeHeader(value)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint := gcs.New(c.m)
+	if body == nil {
+		// Unknown format. Reset the fingerprint.
+		return fingerprint, nil
+	}
+
+	if h == c.header() {
+		fingerprint.SetLimits(c.limits())
+		if err := fingerprint.UnmarshalBinary(body); err != nil {
+			return nil, err
+		}
+		return fingerprint, nil
+	}
+
+	// Hash values are generated by modulo n*p. If the previous range is
+	// a multiple of the current range, the values can be converted.
+	prevRange, curRange := h.n*h.p, c.n*c.p
+	if prevRange%curRange != 0 {
+		return fingerprint, nil
+	}
+
+	// The header is controlled by the client. Don't trust its n
+	// for the number of entries.
+	limits := c.limits()
+	limits.MaxValue = prevRange
+
+	prev := gcs.New(h.m)
+	prev.SetLimits(limits)
+	if err := prev.UnmarshalBinary(body); err != nil {
+		return nil, err
+	}
+
+	for _, v := range prev.Values() {
+		fingerprint.Add(v % curRange)
+	}
+
+	if fingerprint.Len() > limits.MaxLen {
+		return nil, &gcs.DecodeError{Reason: "too many values"}
+	}
+	return fingerprint, nil
+}
+
+// decodeHeader decodes the cookie value and parses the header. It
+// returns nil body if the value has unknown version or header.
+func (c *Casper) decodeHeader(value string) ([]byte, fingerprintHeader, error) {
+	if len(value) > maxCookieLength {
+		return nil, fingerprintHeader{}, &gcs.DecodeError{Reason: "text is too long"}
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fingerprintHeader{}, &gcs.DecodeError{Reason: "failed base64 decoding: " + err.Error()}
+	}
+
+	h, body, ok := parseFingerprintHeader(b)
+	if !ok || h.version != fingerprintVersion {
+		return nil, h, nil
+	}
+
+	if body == nil {
+		// Header only (empty fingerprint).
+		body = []byte{}
+	}
+	return body, h, nil
+}
+
+// Fingerprint is the decoded fingerprint cookie. It's used for
+// inspecting the cookie value (e.g., for debugging).
+type Fingerprint struct {
+	// Version is the format version of the value. It's zero if the
+	// value has no header (generated by the old version).
+	Version int
+
+	// P, N and M are the parameters which generated the value. For
+	// the value without the header, the casper parameters are used.
+	P, N, M uint
+
+	// Values are the hash values in the fingerprint converted to
+	// the casper parameters. They are what Push uses.
+	Values []uint
+
+	casper *Casper
+	set    *gcs.Set
+}
+
+// InspectCookie decodes the fingerprint cookie value in the same way
+// as Push. Unlike Push, the value without the header is decoded with
+// the casper parameters instead of being discarded.
+func (c *Casper) InspectCookie(value string) (*Fingerprint, error) {
+	body, h, err := c.decodeHeader(value)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Fingerprint{
+		Version: int(h.version),
+		P:       h.p,
+		N:       h.n,
+		M:       h.m,
+		casper:  c,
+	}
+
+	if body == nil {
+		// No header. Assume that it's generated by the casper.
+		b, _ := base64.RawURLEncoding.DecodeString(value)
+		f.Version, f.P, f.N, f.M = 0, c.p, c.n, c.m
+
+		f.set = gcs.New(c.m)
+		f.set.SetLimits(c.limits())
+		if err := f.set.UnmarshalBinary(b); err != nil {
+			return nil, err
+		}
+	} else {
+		f.set, err = c.decodeFingerprint(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	f.Values = f.set.Values()
+	return f, nil
+}
+
+// Contains reports whether the fingerprint claims the target
+// is cached by the client. It may be a false positive.
+func (f *Fingerprint) Contains(target string) bool {
+	return f.set.Contains(f.casper.hashTarget(target))
+}
+
+// FalsePositiveRate returns the probability that Contains returns
+// true for a target which is not cached by the client.
+func (f *Fingerprint) FalsePositiveRate() float64 {
+	return float64(len(f.Values)) / float64(f.casper.n*f.casper.p)
+}
+
+// EstimatedEntries returns the estimated number of targets added to the
+// fingerprint. It can be larger than len(Values) since the hash values
+// of different targets may collide.
+func (f *Fingerprint) EstimatedEntries() float64 {
+	d, r := float64(len(f.Values)), float64(f.casper.n*f.casper.p)
+	if d >= r {
+		return d
+	}
+	return -r * math.Log1p(-d/r)
+}
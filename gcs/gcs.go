@@ -0,0 +1,311 @@
+/*
+Package gcs implements golomb-coded sets, a compressed and probabilistic
+representation of a set of hash values (see [1]).
+
+A Set keeps its values sorted and unique, so it can be encoded by
+Golomb coding at any time without extra work by the caller.
+
+[1]: http://giovanni.bajo.it/post/47119962313/golomb-coded-sets-smaller-than-bloom-filters
+*/
+package gcs
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"sort"
+
+	"github.com/tcnksm/go-casper/internal/encoding/golomb"
+)
+
+// Limits limits the work done by decoding untrusted input (e.g., by
+// UnmarshalText). Zero value of each field means no limit.
+type Limits struct {
+	// MaxTextLen is the maximum length of text for UnmarshalText.
+	MaxTextLen int
+
+	// MaxLen is the maximum number of values.
+	MaxLen int
+
+	// MaxValue is the exclusive upper bound of values. It also limits
+	// the length of each golomb code.
+	MaxValue uint
+}
+
+// DecodeError is returned when the encoded set is malformed
+// or violates the limits.
+type DecodeError struct {
+	Reason string
+}
+
+func (e *DecodeError) Error() string {
+	return "gcs: invalid encoded set: " + e.Reason
+}
+
+// Set is a set of hash values which can be encoded to golomb-coded sets.
+// The zero value is not usable, use New instead.
+type Set struct {
+	p      uint
+	limits Limits
+
+	// values are sorted in increasing order and
+	// do not contain duplicates.
+	values []uint
+}
+
+// New returns a new empty Set which is encoded with the given
+// golomb parameter p.
+func New(p uint) *Set {
+	return &Set{
+		p: p,
+	}
+}
+
+// SetLimits sets the limits which are checked when decoding
+// by UnmarshalBinary and UnmarshalText.
+func (s *Set) SetLimits(limits Limits) {
+	s.limits = limits
+}
+
+// P returns the golomb parameter of the set.
+func (s *Set) P() uint {
+	return s.p
+}
+
+// Len returns the number of values in the set.
+func (s *Set) Len() int {
+	return len(s.values)
+}
+
+// Values returns the values in the set in increasing order.
+// The returned slice must not be modified.
+func (s *Set) Values() []uint {
+	return s.values
+}
+
+// Add adds v to the set. It returns false if v is already in the set.
+func (s *Set) Add(v uint) bool {
+	i := sort.Search(len(s.values), func(i int) bool {
+		return s.values[i] >= v
+	})
+	if i < len(s.values) && s.values[i] == v {
+		return false
+	}
+
+	s.values = append(s.values, 0)
+	copy(s.values[i+1:], s.values[i:])
+	s.values[i] = v
+	return true
+}
+
+// Contains reports whether v is in the set.
+// It runs in O(log n) time by binary search.
+func (s *Set) Contains(v uint) bool {
+	i := sort.Search(len(s.values), func(i int) bool {
+		return s.values[i] >= v
+	})
+	return i < len(s.values) && s.values[i] == v
+}
+
+// Remove removes v from the set. It returns false if v is not in the set.
+func (s *Set) Remove(v uint) bool {
+	i := sort.Search(len(s.values), func(i int) bool {
+		return s.values[i] >= v
+	})
+	if i == len(s.values) || s.values[i] != v {
+		return false
+	}
+
+	s.values = append(s.values[:i], s.values[i+1:]...)
+	return true
+}
+
+// Reset removes all values from the set but keeps
+// the allocated storage for reuse.
+func (s *Set) Reset() {
+	s.values = s.values[:0]
+}
+
+// Clone returns a copy of the set including its limits.
+func (s *Set) Clone() *Set {
+	values := make([]uint, len(s.values))
+	copy(values, s.values)
+	return &Set{
+		p:      s.p,
+		limits: s.limits,
+		values: values,
+	}
+}
+
+// Union returns a new set which contains values in s or t.
+// The returned set has same golomb parameter and limits as s.
+func (s *Set) Union(t *Set) *Set {
+	values := make([]uint, 0, len(s.values)+len(t.values))
+
+	i, j := 0, 0
+	for i < len(s.values) && j < len(t.values) {
+		switch a, b := s.values[i], t.values[j]; {
+		case a < b:
+			values = append(values, a)
+			i++
+		case a > b:
+			values = append(values, b)
+			j++
+		default:
+			values = append(values, a)
+			i++
+			j++
+		}
+	}
+	values = append(values, s.values[i:]...)
+	values = append(values, t.values[j:]...)
+
+	return &Set{
+		p:      s.p,
+		limits: s.limits,
+		values: values,
+	}
+}
+
+// Intersect returns a new set which contains values both in s and t.
+// The returned set has same golomb parameter and limits as s.
+func (s *Set) Intersect(t *Set) *Set {
+	var values []uint
+
+	i, j := 0, 0
+	for i < len(s.values) && j < len(t.values) {
+		switch a, b := s.values[i], t.values[j]; {
+		case a < b:
+			i++
+		case a > b:
+			j++
+		default:
+			values = append(values, a)
+			i++
+			j++
+		}
+	}
+
+	return &Set{
+		p:      s.p,
+		limits: s.limits,
+		values: values,
+	}
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+// It returns golomb-coded values of the set.
+func (s *Set) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := golomb.Encode(&buf, s.values, s.p); err != nil {
+		return nil, fmt.Errorf("failed golomb coding: %s", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+// It decodes golomb-coded values with the golomb parameter of the set
+// and replaces the values of the set with them.
+func (s *Set) UnmarshalBinary(data []byte) error {
+	// Decode into the existing buffer to avoid allocation
+	// when the set is reused.
+	values, err := golomb.AppendDecodeWithLimits(s.values[:0], bytes.NewReader(data), s.p, s.golombLimits())
+	if err != nil {
+		s.values = values[:0]
+		if e, ok := err.(*golomb.DecodeError); ok {
+			return &DecodeError{Reason: e.Reason}
+		}
+		return fmt.Errorf("failed golomb decoding: %s", err)
+	}
+
+	// Decoded values are never decreasing but may contain
+	// duplicates when the input was not generated by Set.
+	s.values = values[:0]
+	for i, v := range values {
+		if i > 0 && v == s.values[len(s.values)-1] {
+			continue
+		}
+		s.values = append(s.values, v)
+	}
+
+	return nil
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+// It returns the base64url (without padding) encoded MarshalBinary output.
+func (s *Set) MarshalText() ([]byte, error) {
+	b, err := s.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	text := make([]byte, base64.RawURLEncoding.EncodedLen(len(b)))
+	base64.RawURLEncoding.Encode(text, b)
+	return text, nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (s *Set) UnmarshalText(text []byte) error {
+	if s.limits.MaxTextLen != 0 && len(text) > s.limits.MaxTextLen {
+		s.values = s.values[:0]
+		return &DecodeError{Reason: "text is too long"}
+	}
+
+	b := make([]byte, base64.RawURLEncoding.DecodedLen(len(text)))
+	n, err := base64.RawURLEncoding.Decode(b, text)
+	if err != nil {
+		s.values = s.values[:0]
+		return &DecodeError{Reason: fmt.Sprintf("failed base64 decoding: %s", err)}
+	}
+	return s.UnmarshalBinary(b[:n])
+}
+
+func (s *Set) golombLimits() golomb.Limits {
+	limits := golomb.Limits{
+		MaxValues: s.limits.MaxLen,
+		MaxValue:  s.limits.MaxValue,
+	}
+
+	// Differences are less than MaxValue so longer
+	// unary code is never valid.
+	if s.limits.MaxValue != 0 && s.p != 0 {
+		limits.MaxQuotient = s.limits.MaxValue / s.p
+	}
+	return limits
+}
+
+// ContainsEncoded reports whether v is in the set encoded by MarshalBinary
+// with golomb parameter p. It runs directly against the encoded values
+// without decoding the whole set and stops as soon as decoded values
+// pass v. If limits is not nil, it returns *DecodeError when the
+// encoded values violate it.
+func ContainsEncoded(data []byte, p, v uint, limits *Limits) (bool, error) {
+	s := &Set{p: p}
+	if limits != nil {
+		s.limits = *limits
+	}
+
+	ok, err := golomb.Contains(bytes.NewReader(data), p, v, s.golombLimits())
+	if err != nil {
+		if e, ok := err.(*golomb.DecodeError); ok {
+			return false, &DecodeError{Reason: e.Reason}
+		}
+		return false, fmt.Errorf("failed golomb decoding: %s", err)
+	}
+	return ok, nil
+}
+
+// ContainsText is like ContainsEncoded but for the set
+// encoded by MarshalText.
+func ContainsText(text []byte, p, v uint, limits *Limits) (bool, error) {
+	if limits != nil && limits.MaxTextLen != 0 && len(text) > limits.MaxTextLen {
+		return false, &DecodeError{Reason: "text is too long"}
+	}
+
+	b := make([]byte, base64.RawURLEncoding.DecodedLen(len(text)))
+	n, err := base64.RawURLEncoding.Decode(b, text)
+	if err != nil {
+		return false, &DecodeError{Reason: fmt.Sprintf("failed base64 decoding: %s", err)}
+	}
+	return ContainsEncoded(b[:n], p, v, limits)
+}
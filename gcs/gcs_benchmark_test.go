@@ -0,0 +1,96 @@
+package gcs
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// linearSearch is the previous implementation of Contains.
+// It's kept for comparing performance.
+func linearSearch(a []uint, h uint) bool {
+	for i := 0; i < len(a); i++ {
+		if h == a[i] {
+			return true
+		}
+
+		if h < a[i] {
+			return false
+		}
+	}
+	return false
+}
+
+func newBenchmarkSet(n int) (*Set, []uint) {
+	const p = 1 << 6
+	rnd := rand.New(rand.NewSource(1))
+
+	s := New(p)
+	for s.Len() < n {
+		s.Add(uint(rnd.Int63n(int64(n * p))))
+	}
+
+	queries := make([]uint, 1024)
+	for i := range queries {
+		queries[i] = uint(rnd.Int63n(int64(n * p)))
+	}
+	return s, queries
+}
+
+func BenchmarkLinearSearch(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		s, queries := newBenchmarkSet(n)
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				linearSearch(s.Values(), queries[i%len(queries)])
+			}
+		})
+	}
+}
+
+func BenchmarkContains(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		s, queries := newBenchmarkSet(n)
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				s.Contains(queries[i%len(queries)])
+			}
+		})
+	}
+}
+
+func BenchmarkContainsEncoded(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		s, queries := newBenchmarkSet(n)
+		data, err := s.MarshalBinary()
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				ContainsEncoded(data, s.P(), queries[i%len(queries)], nil)
+			}
+		})
+	}
+}
+
+// BenchmarkUnmarshalContains decodes the whole set before the
+// query. This is what Casper.Push did for every request.
+func BenchmarkUnmarshalContains(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		s, queries := newBenchmarkSet(n)
+		data, err := s.MarshalBinary()
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			decoded := New(s.P())
+			for i := 0; i < b.N; i++ {
+				decoded.UnmarshalBinary(data)
+				linearSearch(decoded.Values(), queries[i%len(queries)])
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package gcs
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+var (
+	_ encoding.BinaryMarshaler   = (*Set)(nil)
+	_ encoding.BinaryUnmarshaler = (*Set)(nil)
+	_ encoding.TextMarshaler     = (*Set)(nil)
+	_ encoding.TextUnmarshaler   = (*Set)(nil)
+)
+
+func TestSet(t *testing.T) {
+	s := New(1 << 6)
+	for _, v := range []uint{104, 65, 151, 65} {
+		s.Add(v)
+	}
+
+	if got, want := s.Values(), []uint{65, 104, 151}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Values=%v, want=%v", got, want)
+	}
+
+	if got, want := s.Len(), 3; got != want {
+		t.Fatalf("Len=%d, want=%d", got, want)
+	}
+
+	cases := []struct {
+		v    uint
+		want bool
+	}{
+		{0, false},
+		{65, true},
+		{100, false},
+		{104, true},
+		{151, true},
+		{200, false},
+	}
+
+	for _, tc := range cases {
+		if got := s.Contains(tc.v); got != tc.want {
+			t.Errorf("Contains(%d)=%v, want=%v", tc.v, got, tc.want)
+		}
+	}
+
+	if !s.Remove(104) {
+		t.Fatalf("Remove(104) should return true")
+	}
+
+	if s.Remove(104) {
+		t.Fatalf("Remove(104) should return false when it's already removed")
+	}
+
+	if got, want := s.Values(), []uint{65, 151}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Values=%v, want=%v", got, want)
+	}
+}
+
+func TestUnionIntersect(t *testing.T) {
+	cases := []struct {
+		a, b      []uint
+		union     []uint
+		intersect []uint
+	}{
+		{
+			[]uint{1, 3, 5},
+			[]uint{2, 3, 6},
+			[]uint{1, 2, 3, 5, 6},
+			[]uint{3},
+		},
+		{
+			[]uint{1, 2},
+			nil,
+			[]uint{1, 2},
+			nil,
+		},
+		{
+			[]uint{4, 8},
+			[]uint{4, 8},
+			[]uint{4, 8},
+			[]uint{4, 8},
+		},
+	}
+
+	for _, tc := range cases {
+		a, b := New(1<<6), New(1<<6)
+		for _, v := range tc.a {
+			a.Add(v)
+		}
+		for _, v := range tc.b {
+			b.Add(v)
+		}
+
+		if got := a.Union(b).Values(); !reflect.DeepEqual(got, tc.union) {
+			t.Errorf("Union(%v, %v)=%v, want=%v", tc.a, tc.b, got, tc.union)
+		}
+
+		if got := a.Intersect(b).Values(); !reflect.DeepEqual(got, tc.intersect) {
+			t.Errorf("Intersect(%v, %v)=%v, want=%v", tc.a, tc.b, got, tc.intersect)
+		}
+	}
+}
+
+func TestMarshalText(t *testing.T) {
+	cases := []struct {
+		values []uint
+		p      uint
+		text   string
+	}{
+		{nil, 1 << 6, ""},
+		{[]uint{151}, 1 << 6, "y4A"},
+		{[]uint{65, 104}, 1 << 6, "gU4"},
+	}
+
+	for _, tc := range cases {
+		s := New(tc.p)
+		for _, v := range tc.values {
+			s.Add(v)
+		}
+
+		text, err := s.MarshalText()
+		if err != nil {
+			t.Fatalf("MarshalText should not fail: %s", err)
+		}
+
+		if got := string(text); got != tc.text {
+			t.Fatalf("MarshalText=%q, want=%q", got, tc.text)
+		}
+
+		decoded := New(tc.p)
+		if err := decoded.UnmarshalText(text); err != nil {
+			t.Fatalf("UnmarshalText should not fail: %s", err)
+		}
+
+		if got, want := decoded.Values(), s.Values(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("UnmarshalText=%v, want=%v", got, want)
+		}
+	}
+}
+
+func TestUnmarshalText_Limits(t *testing.T) {
+	cases := []struct {
+		text   string
+		limits Limits
+	}{
+		{"gU4", Limits{MaxTextLen: 2}},
+		{"gU4", Limits{MaxLen: 1}},
+		{"gU4", Limits{MaxValue: 100}},
+		{"gU4!", Limits{}},
+	}
+
+	for _, tc := range cases {
+		s := New(1 << 6)
+		s.SetLimits(tc.limits)
+
+		err := s.UnmarshalText([]byte(tc.text))
+		if _, ok := err.(*DecodeError); !ok {
+			t.Errorf("UnmarshalText(%q) should return *DecodeError: %v", tc.text, err)
+		}
+
+		if _, err := ContainsText([]byte(tc.text), 1<<6, 104, &tc.limits); err == nil {
+			t.Errorf("ContainsText(%q) should fail", tc.text)
+		}
+
+		if s.Len() != 0 {
+			t.Errorf("Set should be empty after failure")
+		}
+	}
+}
+
+func TestDerivedSet_Limits(t *testing.T) {
+	s := New(1 << 6)
+	s.SetLimits(Limits{MaxLen: 1})
+
+	sets := map[string]*Set{
+		"Clone":     s.Clone(),
+		"Union":     s.Union(New(1 << 6)),
+		"Intersect": s.Intersect(New(1 << 6)),
+	}
+
+	for name, set := range sets {
+		if err := set.UnmarshalText([]byte("gU4")); err == nil {
+			t.Errorf("%s should keep the limits", name)
+		}
+	}
+}
+
+func TestContainsText(t *testing.T) {
+	s := New(1 << 6)
+	for _, v := range []uint{65, 104, 151, 300} {
+		s.Add(v)
+	}
+
+	text, err := s.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []uint{0, 65, 66, 104, 151, 152, 300, 1000} {
+		got, err := ContainsText(text, s.P(), v, nil)
+		if err != nil {
+			t.Fatalf("ContainsText should not fail: %s", err)
+		}
+
+		if want := s.Contains(v); got != want {
+			t.Errorf("ContainsText(%d)=%v, want=%v", v, got, want)
+		}
+	}
+}
+
+func ExampleSet() {
+	s := New(1 << 6)
+	s.Add(104)
+	s.Add(65)
+
+	text, _ := s.MarshalText()
+	fmt.Println(string(text))
+	// Output: gU4
+}
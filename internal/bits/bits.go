@@ -1,91 +1,352 @@
 package bits
 
 import (
-	"encoding/binary"
+	"bufio"
+	"errors"
 	"io"
+	mathbits "math/bits"
 )
 
-// Writer writes bits into underlying io.Writer
+const (
+	// maxBits is the maximum number of bits which can be
+	// written or read by one call.
+	maxBits = 56
+
+	// bufferSize is the size of output buffer of Writer.
+	bufferSize = 64
+)
+
+var (
+	// ErrInvalidWidth is returned when the number of bits to read or
+	// write is negative or wider than uint.
+	ErrInvalidWidth = errors.New("bits: invalid number of bits")
+
+	// ErrRunTooLong is returned by ReadUnaryMax when the unary code
+	// is longer than the limit.
+	ErrRunTooLong = errors.New("bits: unary code is too long")
+)
+
+// Writer writes bits into underlying io.Writer or byte slice.
+// Bits are accumulated in 64-bit integer and written byte by byte
+// to the internal buffer. The buffer is written to the underlying
+// io.Writer only when it's full or Flush is called.
 type Writer struct {
-	n int  // current number of bits
-	v uint // current accumulated value
+	n   uint   // current number of bits
+	acc uint64 // current accumulated value
 
-	wr io.Writer
+	buf []byte
+	wr  io.Writer // nil when writing to byte slice
 }
 
 // NewWriter returns a new Writer.
 func NewWriter(w io.Writer) *Writer {
 	return &Writer{
-		wr: w,
+		buf: make([]byte, 0, bufferSize),
+		wr:  w,
 	}
 }
 
-// Write writes bits with give size n.
+// NewBytesWriter returns a new Writer which appends bits
+// to the given byte slice. The result can be retrieved by Bytes.
+func NewBytesWriter(dst []byte) *Writer {
+	return &Writer{
+		buf: dst,
+	}
+}
+
+// Write writes bits with give size n. n can be up to the size of uint.
+// Writes wider than 56 bits are split into two writes.
 func (w *Writer) Write(bits uint, n int) error {
-	w.v <<= uint(n)
-	w.v |= bits & mask(n)
-	w.n += n
-	for w.n >= 8 {
-		b := (w.v >> (uint(w.n) - 8)) & mask(8)
-		if err := binary.Write(w.wr, binary.BigEndian, uint8(b)); err != nil {
+	if n < 0 || n > mathbits.UintSize {
+		return ErrInvalidWidth
+	}
+
+	if n > maxBits {
+		if err := w.Write(bits>>32, n-32); err != nil {
 			return err
 		}
+		return w.Write(bits&mask(32), 32)
+	}
+
+	w.acc = w.acc<<uint(n) | uint64(bits)&mask64(uint(n))
+	w.n += uint(n)
+	for w.n >= 8 {
 		w.n -= 8
+		w.buf = append(w.buf, byte(w.acc>>w.n))
 	}
-	w.v &= mask(8)
+	w.acc &= mask64(w.n)
 
+	if w.wr != nil && len(w.buf) >= bufferSize {
+		return w.flushBuffer()
+	}
 	return nil
 }
 
+// WriteUnary writes unary code of q, q one bits followed by a zero bit.
+// q can be any length.
+func (w *Writer) WriteUnary(q uint) error {
+	for q >= maxBits {
+		if err := w.Write(uint(mask64(maxBits)), maxBits); err != nil {
+			return err
+		}
+		q -= maxBits
+	}
+	return w.Write(uint(mask64(uint(q+1))-1), int(q+1))
+}
+
 // Flush writes any remaining bits to the underlying io.Writer.
 // bits will be left-shifted.
 func (w *Writer) Flush() error {
 	if w.n != 0 {
-		b := (w.v << (8 - uint(w.n))) & mask(8)
-		if err := binary.Write(w.wr, binary.BigEndian, uint8(b)); err != nil {
-			return err
-		}
+		w.buf = append(w.buf, byte(w.acc<<(8-w.n)))
+		w.n, w.acc = 0, 0
+	}
+
+	if w.wr != nil {
+		return w.flushBuffer()
 	}
 	return nil
 }
 
-// Reader reads bits from the given io.Reader.
+// Bytes returns the bytes written so far. It's only for
+// the Writer created by NewBytesWriter.
+func (w *Writer) Bytes() []byte {
+	return w.buf
+}
+
+func (w *Writer) flushBuffer() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	_, err := w.wr.Write(w.buf)
+	w.buf = w.buf[:0]
+	return err
+}
+
+// Reader reads bits from the given io.Reader or byte slice.
 type Reader struct {
-	n int  // current number of bits
-	v uint // current accumulated value
+	n   uint   // current number of bits
+	acc uint64 // current accumulated value
+
+	src []byte
+	br  io.ByteReader // nil when reading from byte slice
 
-	rd io.Reader
+	eof bool  // source is exhausted
+	err error // error from io.ByteReader except io.EOF
 }
 
-// NewReader returns new a new Reader.
+// NewReader returns new a new Reader. If rd does not implement
+// io.ByteReader, it's wrapped by bufio.Reader.
 func NewReader(rd io.Reader) *Reader {
+	br, ok := rd.(io.ByteReader)
+	if !ok {
+		br = bufio.NewReader(rd)
+	}
 	return &Reader{
-		rd: rd,
+		br: br,
 	}
 }
 
+// NewBytesReader returns a new Reader which reads bits
+// from the given byte slice.
+func NewBytesReader(src []byte) *Reader {
+	return &Reader{
+		src: src,
+	}
+}
+
+// Read reads n bits. n can be up to the size of uint. It returns io.EOF
+// with the value when the read reaches the end of the source. If there
+// are less than n bits, the value is padded by zero bits.
 func (r *Reader) Read(n int) (uint, error) {
-	var err error
-
-	for r.n <= n {
-		r.v <<= 8
-		var b uint8
-		err = binary.Read(r.rd, binary.BigEndian, &b)
-		if err != nil && err != io.EOF {
-			return 0, err
+	if n < 0 || n > mathbits.UintSize {
+		return 0, ErrInvalidWidth
+	}
+
+	if n > maxBits {
+		hi, err := r.Read(n - 32)
+		if err != nil {
+			// Remaining bits are all padding.
+			return hi << 32, err
 		}
-		r.v |= uint(b)
+		lo, err := r.Read(32)
+		return hi<<32 | lo, err
+	}
 
-		r.n += 8
+	// Fill when it's not enough. It also fills when it has exactly
+	// n bits to know it reaches the end of the source or not.
+	if r.n <= uint(n) {
+		r.fill()
+	}
+
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	if r.n < uint(n) {
+		v := r.acc << (uint(n) - r.n)
+		r.n, r.acc = 0, 0
+		return uint(v), io.EOF
+	}
+
+	r.n -= uint(n)
+	v := r.acc >> r.n
+	r.acc &= mask64(r.n)
+
+	if r.eof && r.n == 0 {
+		return uint(v), io.EOF
+	}
+	return uint(v), nil
+}
+
+// Peek returns next n bits without advancing the reader. n must be
+// at most 56. If there are less than n bits, the value is padded by
+// zero bits and io.EOF is returned.
+func (r *Reader) Peek(n int) (uint, error) {
+	if n < 0 || n > maxBits {
+		return 0, ErrInvalidWidth
+	}
+
+	if r.n < uint(n) {
+		r.fill()
+	}
+
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	if r.n < uint(n) {
+		return uint(r.acc << (uint(n) - r.n)), io.EOF
+	}
+	return uint(r.acc >> (r.n - uint(n))), nil
+}
+
+// Skip skips next n bits. It returns io.EOF if there are less
+// than n bits.
+func (r *Reader) Skip(n int) error {
+	if n < 0 {
+		return ErrInvalidWidth
 	}
-	v := r.v >> uint(r.n-n)
 
-	r.n -= n
-	r.v &= mask(r.n)
+	for n > 0 {
+		if r.n == 0 {
+			r.fill()
+			if r.err != nil {
+				return r.err
+			}
+
+			if r.n == 0 {
+				return io.EOF
+			}
+		}
+
+		k := uint(n)
+		if k > r.n {
+			k = r.n
+		}
+		r.n -= k
+		r.acc &= mask64(r.n)
+		n -= int(k)
+	}
+	return nil
+}
 
-	return v, err
+// ReadUnary reads unary code, one bits terminated by a zero bit, and
+// returns the number of one bits. The run can be any length. It
+// returns io.EOF (with the value) when the source is exhausted after
+// the terminating zero bit or there are no bits at all, and
+// io.ErrUnexpectedEOF when the source ends before the terminating bit.
+func (r *Reader) ReadUnary() (uint, error) {
+	return r.ReadUnaryMax(^uint(0))
+}
+
+// ReadUnaryMax is like ReadUnary but it returns ErrRunTooLong as soon
+// as the number of one bits exceeds max. It's for reading untrusted
+// input without scanning a long run of one bits.
+func (r *Reader) ReadUnaryMax(max uint) (uint, error) {
+	var q uint
+	for {
+		if q > max {
+			return 0, ErrRunTooLong
+		}
+
+		if r.n == 0 {
+			r.fill()
+			if r.err != nil {
+				return 0, r.err
+			}
+
+			if r.n == 0 {
+				if q == 0 {
+					return 0, io.EOF
+				}
+				return q, io.ErrUnexpectedEOF
+			}
+		}
+
+		// Count leading one bits of the accumulated bits.
+		ones := uint(mathbits.LeadingZeros64(^(r.acc << (64 - r.n))))
+		if ones >= r.n {
+			q += r.n
+			r.n, r.acc = 0, 0
+			continue
+		}
+
+		q += ones
+		if q > max {
+			return 0, ErrRunTooLong
+		}
+		r.n -= ones + 1
+		r.acc &= mask64(r.n)
+
+		if r.n == 0 {
+			r.fill()
+			if r.err != nil {
+				return 0, r.err
+			}
+
+			if r.n == 0 {
+				return q, io.EOF
+			}
+		}
+		return q, nil
+	}
+}
+
+// fill fills the accumulator until it has more than maxBits bits
+// or the source is exhausted.
+func (r *Reader) fill() {
+	if r.br == nil {
+		for r.n <= maxBits && len(r.src) > 0 {
+			r.acc = r.acc<<8 | uint64(r.src[0])
+			r.src = r.src[1:]
+			r.n += 8
+		}
+		r.eof = len(r.src) == 0
+		return
+	}
+
+	for r.n <= maxBits && !r.eof {
+		b, err := r.br.ReadByte()
+		if err == io.EOF {
+			r.eof = true
+			break
+		}
+
+		if err != nil {
+			r.err = err
+			break
+		}
+		r.acc = r.acc<<8 | uint64(b)
+		r.n += 8
+	}
 }
 
 func mask(n int) uint {
 	return (1 << uint(n)) - 1
 }
+
+func mask64(n uint) uint64 {
+	return (1 << n) - 1
+}
@@ -1,14 +1,84 @@
 package bits
 
 import (
+	"bufio"
+	"bytes"
 	"io/ioutil"
 	"testing"
 )
 
 func BenchmarkWrite(b *testing.B) {
 	writer := NewWriter(ioutil.Discard)
+	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		writer.Write(0xff, 8)
 	}
 }
+
+func BenchmarkWrite_Bits(b *testing.B) {
+	writer := NewWriter(ioutil.Discard)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		writer.Write(0x5, 3)
+	}
+}
+
+func BenchmarkBytesWriter(b *testing.B) {
+	dst := make([]byte, 0, 1024)
+	writer := NewBytesWriter(dst)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if len(writer.Bytes()) == cap(dst) {
+			writer = NewBytesWriter(dst)
+		}
+		writer.Write(0xff, 8)
+	}
+}
+
+func BenchmarkRead(b *testing.B) {
+	src := make([]byte, 1<<20)
+	rd := bytes.NewReader(src)
+	reader := NewReader(bufio.NewReader(rd))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := reader.Read(8); err != nil {
+			rd.Reset(src)
+			reader = NewReader(rd)
+		}
+	}
+}
+
+func BenchmarkBytesReader(b *testing.B) {
+	src := make([]byte, 1<<20)
+	reader := NewBytesReader(src)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := reader.Read(8); err != nil {
+			reader = NewBytesReader(src)
+		}
+	}
+}
+
+func BenchmarkReadUnary(b *testing.B) {
+	var buf bytes.Buffer
+	writer := NewWriter(&buf)
+	for i := 0; i < 1<<16; i++ {
+		writer.WriteUnary(uint(i % 16))
+	}
+	writer.Flush()
+
+	src := buf.Bytes()
+	reader := NewBytesReader(src)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := reader.ReadUnary(); err != nil {
+			reader = NewBytesReader(src)
+		}
+	}
+}
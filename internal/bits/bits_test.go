@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
+	mathbits "math/bits"
 	"testing"
 )
 
@@ -71,6 +73,273 @@ func TestWriter(t *testing.T) {
 	}
 }
 
+func TestBytesReader(t *testing.T) {
+	reader := NewBytesReader([]byte{0xff, 0x0f}) // 1111 1111 0000 1111
+
+	cases := []struct {
+		n    int
+		want uint
+		err  error
+	}{
+		{2, 3, nil},     // 11
+		{3, 7, nil},     // 111
+		{5, 28, nil},    // 11100
+		{3, 1, nil},     // 001
+		{3, 7, io.EOF},  // 111
+		{3, 0, io.EOF},  // padded
+		{0, 0, io.EOF},  // nothing
+		{56, 0, io.EOF}, // padded
+	}
+
+	for _, tc := range cases {
+		got, err := reader.Read(tc.n)
+		if err != tc.err {
+			t.Fatalf("Read(%d) returns error %v, want %v", tc.n, err, tc.err)
+		}
+
+		if got != tc.want {
+			t.Errorf("Read(%d)=%b, want=%b", tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestReader_Wide(t *testing.T) {
+	input := []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef, 0xfe}
+	for _, reader := range []*Reader{
+		NewReader(bytes.NewReader(input)),
+		NewReader(struct{ io.Reader }{bytes.NewReader(input)}), // not io.ByteReader
+		NewBytesReader(input),
+	} {
+		got, err := reader.Read(56)
+		if err != nil {
+			t.Fatalf("Read(56) should not fail: %s", err)
+		}
+
+		if want := uint(0x0123456789abcd); got != want {
+			t.Fatalf("Read(56)=%x, want=%x", got, want)
+		}
+
+		got, err = reader.Read(16)
+		if err != io.EOF {
+			t.Fatalf("Read(16) should return io.EOF: %v", err)
+		}
+
+		if want := uint(0xeffe); got != want {
+			t.Fatalf("Read(16)=%x, want=%x", got, want)
+		}
+	}
+}
+
+func TestBytesWriter(t *testing.T) {
+	writer := NewBytesWriter([]byte{0xaa})
+	for _, input := range []uint{0x1234567, 0xf} {
+		if err := writer.Write(input, 28); err != nil {
+			t.Fatalf("Write should not fail: %s", err)
+		}
+	}
+	writer.Write(1, 1)
+
+	if err := writer.Flush(); err != nil {
+		t.Fatalf("Flush should not fail: %s", err)
+	}
+
+	want := []byte{0xaa, 0x12, 0x34, 0x56, 0x70, 0x00, 0x00, 0x0f, 0x80}
+	if got := writer.Bytes(); !bytes.Equal(got, want) {
+		t.Errorf("Write writes %x, want %x", got, want)
+	}
+}
+
+func TestWriter_Buffered(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewWriter(&buf)
+
+	// Write more than the buffer size.
+	for i := 0; i < bufferSize*3; i++ {
+		if err := writer.Write(uint(i), 8); err != nil {
+			t.Fatalf("Write should not fail: %s", err)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		t.Fatalf("Flush should not fail: %s", err)
+	}
+
+	if got, want := buf.Len(), bufferSize*3; got != want {
+		t.Fatalf("Write writes %d bytes, want %d", got, want)
+	}
+
+	for i, b := range buf.Bytes() {
+		if b != byte(i) {
+			t.Fatalf("byte %d is %x, want %x", i, b, byte(i))
+		}
+	}
+}
+
+func TestUnary(t *testing.T) {
+	inputs := []uint{0, 1, 7, 55, 56, 57, 200, 1000, 3}
+
+	var buf bytes.Buffer
+	writer := NewWriter(&buf)
+	for _, q := range inputs {
+		if err := writer.WriteUnary(q); err != nil {
+			t.Fatalf("WriteUnary(%d) should not fail: %s", q, err)
+		}
+
+		// Separator
+		if err := writer.Write(0x5, 3); err != nil {
+			t.Fatalf("Write should not fail: %s", err)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		t.Fatalf("Flush should not fail: %s", err)
+	}
+
+	reader := NewReader(bytes.NewReader(buf.Bytes()))
+	for _, want := range inputs {
+		got, err := reader.ReadUnary()
+		if err != nil {
+			t.Fatalf("ReadUnary should not fail: %s", err)
+		}
+
+		if got != want {
+			t.Fatalf("ReadUnary=%d, want=%d", got, want)
+		}
+
+		if v, _ := reader.Read(3); v != 0x5 {
+			t.Fatalf("Read(3)=%b, want=101", v)
+		}
+	}
+}
+
+func TestUnary_EOF(t *testing.T) {
+	cases := []struct {
+		input []byte
+		want  uint
+		err   error
+	}{
+		{[]byte{}, 0, io.EOF},
+		{[]byte{0xfe}, 7, io.EOF},
+		{[]byte{0xff, 0xff}, 16, io.ErrUnexpectedEOF},
+		{[]byte{0xff, 0x7f}, 8, nil},
+	}
+
+	for _, tc := range cases {
+		got, err := NewBytesReader(tc.input).ReadUnary()
+		if err != tc.err {
+			t.Errorf("ReadUnary(%x) returns error %v, want %v", tc.input, err, tc.err)
+		}
+
+		if got != tc.want {
+			t.Errorf("ReadUnary(%x)=%d, want=%d", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestReadUnaryMax(t *testing.T) {
+	input := []byte{0xff, 0xff, 0xff, 0xfe, 0x00} // 31 one bits
+
+	if _, err := NewBytesReader(input).ReadUnaryMax(30); err != ErrRunTooLong {
+		t.Fatalf("ReadUnaryMax(30) should return ErrRunTooLong: %v", err)
+	}
+
+	got, err := NewBytesReader(input).ReadUnaryMax(31)
+	if err != nil {
+		t.Fatalf("ReadUnaryMax(31) should not fail: %s", err)
+	}
+
+	if got != 31 {
+		t.Fatalf("ReadUnaryMax(31)=%d, want=31", got)
+	}
+}
+
+func TestPeekSkip(t *testing.T) {
+	reader := NewBytesReader([]byte{0xa5, 0xf0}) // 1010 0101 1111 0000
+
+	if got, _ := reader.Peek(4); got != 0xa {
+		t.Fatalf("Peek(4)=%b, want=1010", got)
+	}
+
+	// Peek does not advance the reader.
+	if got, _ := reader.Read(4); got != 0xa {
+		t.Fatalf("Read(4)=%b, want=1010", got)
+	}
+
+	if err := reader.Skip(6); err != nil {
+		t.Fatalf("Skip should not fail: %s", err)
+	}
+
+	if got, _ := reader.Peek(4); got != 0xc {
+		t.Fatalf("Peek(4)=%b, want=1100", got)
+	}
+
+	if got, err := reader.Peek(8); got != 0xc0 || err != io.EOF {
+		t.Fatalf("Peek(8)=%b, %v, want=11000000, io.EOF", got, err)
+	}
+
+	if err := reader.Skip(7); err != io.EOF {
+		t.Fatalf("Skip should return io.EOF: %v", err)
+	}
+}
+
+func TestWide(t *testing.T) {
+	if mathbits.UintSize != 64 {
+		t.Skip("uint is not 64 bits")
+	}
+
+	want := uint(0x0123456789abcdef)
+
+	var buf bytes.Buffer
+	writer := NewWriter(&buf)
+	writer.Write(1, 1)
+	if err := writer.Write(want, 64); err != nil {
+		t.Fatalf("Write(64) should not fail: %s", err)
+	}
+	writer.Flush()
+
+	reader := NewReader(bytes.NewReader(buf.Bytes()))
+	reader.Read(1)
+	got, err := reader.Read(64)
+	if err != nil {
+		t.Fatalf("Read(64) should not fail: %s", err)
+	}
+
+	if got != want {
+		t.Fatalf("Read(64)=%x, want=%x", got, want)
+	}
+
+	if err := writer.Write(0, 65); err != ErrInvalidWidth {
+		t.Fatalf("Write(65) should return ErrInvalidWidth: %v", err)
+	}
+
+	if _, err := reader.Read(-1); err != ErrInvalidWidth {
+		t.Fatalf("Read(-1) should return ErrInvalidWidth: %v", err)
+	}
+
+	if _, err := reader.Peek(57); err != ErrInvalidWidth {
+		t.Fatalf("Peek(57) should return ErrInvalidWidth: %v", err)
+	}
+}
+
+func TestAllocs(t *testing.T) {
+	writer := NewWriter(ioutil.Discard)
+	if n := testing.AllocsPerRun(100, func() {
+		writer.Write(0xff, 8)
+		writer.Write(0x3, 3)
+	}); n != 0 {
+		t.Errorf("Write allocates %v times, want 0", n)
+	}
+
+	src := make([]byte, 1024)
+	reader := NewBytesReader(src)
+	if n := testing.AllocsPerRun(100, func() {
+		reader.Read(8)
+		reader.Read(3)
+	}); n != 0 {
+		t.Errorf("Read allocates %v times, want 0", n)
+	}
+}
+
 func TestMask(t *testing.T) {
 	cases := []struct {
 		input int
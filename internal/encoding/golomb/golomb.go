@@ -2,113 +2,380 @@ package golomb
 
 import (
 	"errors"
-	"io"
-	"math"
-
 	"fmt"
+	"io"
+	mathbits "math/bits"
 
 	"github.com/tcnksm/go-casper/internal/bits"
 )
 
 var errPadding = errors.New("padding")
 
-// DecodeAll decodes...
+// DecodeError is returned when the input is malformed or
+// violates the decoding limits.
+type DecodeError struct {
+	Reason string
+}
+
+func (e *DecodeError) Error() string {
+	return "golomb: " + e.Reason
+}
+
+// Limits limits the work done by decoding untrusted input.
+// Zero value of each field means no limit.
+type Limits struct {
+	// MaxValues is the maximum number of decoded values.
+	MaxValues int
+
+	// MaxQuotient is the maximum quotient (the length of unary code)
+	// of each encoded difference.
+	MaxQuotient uint
+
+	// MaxValue is the exclusive upper bound of decoded values.
+	MaxValue uint
+}
+
+// DecodeAll decodes all golomb-coded values from the given reader.
+// p is the golomb parameter which is used for encoding.
 func DecodeAll(rd io.Reader, p uint) ([]uint, error) {
-	// TODO(tcnksm): Receive dst from outside as argument.
-	var dst []uint
-	br := bits.NewReader(rd)
-	prev := uint(0)
+	dst, err := AppendDecode(nil, rd, p)
+	if err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
+
+// AppendDecode decodes all golomb-coded values from the given reader
+// and appends them to dst. It returns the extended slice. Passing a
+// reused dst (e.g., dst[:0]) avoids allocating a new slice.
+func AppendDecode(dst []uint, rd io.Reader, p uint) ([]uint, error) {
+	return AppendDecodeWithLimits(dst, rd, p, Limits{})
+}
+
+// AppendDecodeWithLimits is like AppendDecode but it stops decoding and
+// returns *DecodeError when the input violates the given limits.
+func AppendDecodeWithLimits(dst []uint, rd io.Reader, p uint, limits Limits) ([]uint, error) {
+	dec := NewDecoderWithLimits(rd, p, limits)
 	for {
-		v, err := decode(br, p)
-		if err == errPadding {
-			// Ignore padding value
+		v, err := dec.Next()
+		if err == io.EOF {
 			return dst, nil
 		}
 
+		if err != nil {
+			return dst, err
+		}
+
+		dst = append(dst, v)
+	}
+}
+
+// Contains reports whether the golomb-coded values read from rd
+// contain v. It stops reading once decoded values pass v.
+func Contains(rd io.Reader, p, v uint, limits Limits) (bool, error) {
+	dec := NewDecoderWithLimits(rd, p, limits)
+	for {
+		got, err := dec.Next()
 		if err == io.EOF {
-			dst = append(dst, v+prev)
-			return dst, nil
+			return false, nil
 		}
 
 		if err != nil {
-			return nil, err
+			return false, err
 		}
 
-		dst = append(dst, v+prev)
+		if got >= v {
+			return got == v, nil
+		}
+	}
+}
+
+// Decoder reads and decodes golomb-coded values one by one from
+// an input stream.
+type Decoder struct {
+	br     *bits.Reader
+	p      uint
+	limits Limits
 
-		prev = v + prev
+	prev  uint
+	count int
+	done  bool
+}
+
+// NewDecoder returns a new decoder that reads from rd.
+// p is the golomb parameter which is used for encoding.
+func NewDecoder(rd io.Reader, p uint) *Decoder {
+	return NewDecoderWithLimits(rd, p, Limits{})
+}
+
+// NewDecoderWithLimits returns a new decoder that reads from rd and
+// returns *DecodeError when the input violates the given limits.
+func NewDecoderWithLimits(rd io.Reader, p uint, limits Limits) *Decoder {
+	return &Decoder{
+		br:     bits.NewReader(rd),
+		p:      p,
+		limits: limits,
 	}
 }
 
-func decode(br *bits.Reader, p uint) (uint, error) {
-	var v uint
+// Next returns the next decoded value. Values are returned in
+// increasing order. It returns io.EOF when there are no more values.
+func (d *Decoder) Next() (uint, error) {
+	if d.done {
+		return 0, io.EOF
+	}
+
+	if d.p == 0 {
+		d.done = true
+		return 0, &DecodeError{Reason: "parameter must be positive"}
+	}
+
+	maxQuotient := ^uint(0)
+	if d.limits.MaxQuotient != 0 {
+		maxQuotient = d.limits.MaxQuotient
+	}
+
+	// The empty input is the empty set. Otherwise, all zero bits
+	// at the beginning are the encoded first value zero.
+	var empty bool
+	if d.count == 0 {
+		_, err := d.br.Peek(1)
+		empty = err == io.EOF
+	}
+
+	v, err := decodeMax(d.br, d.p, maxQuotient)
+	if err == errPadding && d.count == 0 && !empty {
+		v, err = 0, io.EOF
+	}
+
+	if err == errPadding {
+		// Ignore padding value
+		d.done = true
+		return 0, io.EOF
+	}
+
+	if err != nil && err != io.EOF {
+		d.done = true
+		return 0, err
+	}
+
+	if d.count > 0 && v == 0 {
+		// Values are strictly increasing so zero difference
+		// (all zero bits) is only allowed as padding.
+		d.done = true
+		if err == nil && !d.zeroPadding() {
+			return 0, &DecodeError{Reason: "values are not increasing"}
+		}
+		return 0, io.EOF
+	}
+
+	if err == io.EOF {
+		// This is the last value.
+		d.done = true
+	}
+
+	if d.limits.MaxValues != 0 && d.count >= d.limits.MaxValues {
+		d.done = true
+		return 0, &DecodeError{Reason: "too many values"}
+	}
+
+	if v > ^uint(0)-d.prev || (d.limits.MaxValue != 0 && d.prev+v >= d.limits.MaxValue) {
+		d.done = true
+		return 0, &DecodeError{Reason: "value is out of range"}
+	}
 
-	// Decode unary parts. Sum p until enconter 0 bits.
+	d.count++
+	d.prev += v
+	return d.prev, nil
+}
+
+// zeroPadding reads the rest of the input and reports
+// whether it consists of only zero bits.
+func (d *Decoder) zeroPadding() bool {
 	for {
-		b, err := br.Read(1)
-		if err == io.EOF {
-			if v == 0 {
-				return 0, errPadding
-			}
-			return 0, fmt.Errorf("unexpected bit format")
+		b, err := d.br.Read(8)
+		if b != 0 {
+			return false
 		}
 
 		if err != nil {
-			return 0, err
+			return err == io.EOF
 		}
+	}
+}
+
+func decode(br *bits.Reader, p uint) (uint, error) {
+	return decodeMax(br, p, ^uint(0))
+}
+
+// decodeMax decodes a value whose quotient is at most maxQuotient.
+func decodeMax(br *bits.Reader, p uint, maxQuotient uint) (uint, error) {
+	// Decode unary parts.
+	q, err := br.ReadUnaryMax(maxQuotient)
+	if err == io.EOF && q == 0 {
+		return 0, errPadding
+	}
+
+	if err == io.ErrUnexpectedEOF {
+		return 0, &DecodeError{Reason: "unexpected end of unary code"}
+	}
+
+	if err == bits.ErrRunTooLong {
+		return 0, &DecodeError{Reason: "unary code is too long"}
+	}
 
-		if b == 0 {
-			break
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+
+	if q > ^uint(0)/p {
+		return 0, &DecodeError{Reason: "value overflows"}
+	}
+	v := q * p
+
+	if err == io.EOF {
+		// No bits left for the remainder.
+		if b, _ := remainderCode(p); b != 0 {
+			return 0, &DecodeError{Reason: "unexpected end of remainder"}
 		}
-		v += p
+		return v, io.EOF
 	}
 
 	// Decode remainder parts.
-	bitLen := int(math.Log2(float64(p)))
-	r, err := br.Read(bitLen)
-	if err == io.EOF && r == 0 {
+	r, err := readRemainder(br, p)
+	if err == io.EOF && v == 0 && r == 0 {
 		return 0, errPadding
 	}
 
 	if err != nil && err != io.EOF {
 		return 0, err
 	}
+
+	if r >= p || v > ^uint(0)-r {
+		return 0, &DecodeError{Reason: "invalid remainder"}
+	}
 	v += r
 
 	return v, err
 }
 
+// remainderCode returns the parameters of truncated binary encoding
+// for the remainder of golomb parameter p. Remainders less than u
+// are written in b-1 bits and others are written in b bits.
+//
+// When p is power of two, u is 0 and all remainders are written in
+// b bits (this is same as Rice coding).
+func remainderCode(p uint) (b int, u uint) {
+	b = mathbits.Len(p - 1)
+	u = 1<<uint(b) - p
+	return b, u
+}
+
+// readRemainder reads truncated binary encoded remainder.
+func readRemainder(br *bits.Reader, p uint) (uint, error) {
+	b, u := remainderCode(p)
+	if u == 0 {
+		return br.Read(b)
+	}
+
+	x, err := br.Read(b - 1)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+
+	if x < u {
+		return x, err
+	}
+
+	y, err2 := br.Read(1)
+	if err2 != nil && err2 != io.EOF {
+		return 0, err2
+	}
+
+	if err == nil {
+		err = err2
+	}
+	return (x<<1 | y) - u, err
+}
+
 // Encode encodes the given uint array and writes to underlying writer.
-// p is false-positive probability. The src array must be uniformly
-// distribute set of values.
+// p is the golomb parameter (usually false-positive probability) and it
+// can be any positive integer. The src array must be uniformly distribute
+// set of values and sorted in increasing order.
 func Encode(w io.Writer, src []uint, p uint) error {
 	if len(src) == 0 {
 		return nil
 	}
 
-	// bitLen is number of bits for writing remainder.
-	bitLen := int(math.Log2(float64(p)))
+	enc := NewEncoder(w, p)
+	for _, h := range src {
+		if err := enc.Add(h); err != nil {
+			return err
+		}
+	}
 
-	// TODO(tcnksm)
-	wr := bits.NewWriter(w)
+	return enc.Close()
+}
 
-	prev := uint(0)
-	for _, h := range src {
-		v := h - prev
-		q, r := v/p, v%p
+// Encoder encodes values one by one and writes them to
+// an output stream.
+type Encoder struct {
+	wr      *bits.Writer
+	p       uint
+	prev    uint
+	started bool
 
-		// Write unary code of quotient
-		if err := wr.Write(1<<(uint(q)+1)-2, int(q+1)); err != nil {
+	// b and u are parameters for writing remainder
+	// by truncated binary encoding.
+	b int
+	u uint
+}
+
+// NewEncoder returns a new encoder that writes to w.
+// p is the golomb parameter.
+func NewEncoder(w io.Writer, p uint) *Encoder {
+	b, u := remainderCode(p)
+	return &Encoder{
+		wr: bits.NewWriter(w),
+		p:  p,
+		b:  b,
+		u:  u,
+	}
+}
+
+// Add encodes v and writes it. Values must be added
+// in strictly increasing order.
+func (e *Encoder) Add(v uint) error {
+	if e.started && v <= e.prev {
+		return fmt.Errorf("value %d is not greater than previous value %d", v, e.prev)
+	}
+	e.started = true
+
+	d := v - e.prev
+	q, r := d/e.p, d%e.p
+
+	// Write unary code of quotient
+	if err := e.wr.WriteUnary(q); err != nil {
+		return err
+	}
+
+	// Write remainder by truncated binary encoding
+	if r < e.u {
+		if err := e.wr.Write(r, e.b-1); err != nil {
 			return err
 		}
-
-		// Write remainder
-		if err := wr.Write(r, bitLen); err != nil {
+	} else {
+		if err := e.wr.Write(r+e.u, e.b); err != nil {
 			return err
 		}
-
-		prev = h
 	}
 
-	return wr.Flush()
+	e.prev = v
+	return nil
+}
+
+// Close writes any remaining bits (padded with zero) to the
+// underlying writer. It does not close the underlying writer.
+func (e *Encoder) Close() error {
+	return e.wr.Flush()
 }
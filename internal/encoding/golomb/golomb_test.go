@@ -7,6 +7,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
+	"math/rand"
 	"os"
 	"reflect"
 	"sort"
@@ -128,6 +129,348 @@ func TestEncoding(t *testing.T) {
 	}
 }
 
+func TestEncoding_NonPowerOfTwo(t *testing.T) {
+	cases := []struct {
+		input []uint
+		p     uint
+		want  []byte
+	}{
+		// p=3 writes remainder 0 in 1 bit and 1,2 in 2 bits.
+		// 10|0 0|11 110|11 => 10001111 01100000
+		{
+			[]uint{3, 5, 13},
+			3,
+			[]byte{0x8f, 0x60},
+		},
+
+		// p=48 writes remainder less than 16 in 5 bits
+		// and others in 6 bits.
+		// 0|01010 0|101011 => 00101001 01011000
+		{
+			[]uint{10, 37},
+			48,
+			[]byte{0x29, 0x58},
+		},
+	}
+
+	for _, tc := range cases {
+		var buf bytes.Buffer
+		if err := Encode(&buf, tc.input, tc.p); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := buf.Bytes(); !bytes.Equal(got, tc.want) {
+			t.Errorf("Encode=%x, want=%x", got, tc.want)
+		}
+
+		got, err := DecodeAll(bytes.NewReader(buf.Bytes()), tc.p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(got, tc.input) {
+			t.Errorf("DecodeAll=%v, want=%v", got, tc.input)
+		}
+	}
+}
+
+func TestEncoding_LargeQuotient(t *testing.T) {
+	// Quotients are larger than the size of uint.
+	input := []uint{3, 10000, 10001, 20000}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, input, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := DecodeAll(bytes.NewReader(buf.Bytes()), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, input) {
+		t.Errorf("DecodeAll=%v, want=%v", got, input)
+	}
+}
+
+// TestRoundTrip checks truncated binary encoding produces the same outputs
+// as the previous (Rice coding) implementation for power of two parameters
+// and values can be decoded for any parameters.
+func TestRoundTrip(t *testing.T) {
+	riceEncode := func(src []uint, p uint) []byte {
+		var buf bytes.Buffer
+		wr := bits.NewWriter(&buf)
+		bitLen := 0
+		for 1<<uint(bitLen) < p {
+			bitLen++
+		}
+
+		prev := uint(0)
+		for _, h := range src {
+			q, r := (h-prev)/p, (h-prev)%p
+			for i := uint(0); i < q; i++ {
+				wr.Write(1, 1)
+			}
+			wr.Write(0, 1)
+			wr.Write(r, bitLen)
+			prev = h
+		}
+		wr.Flush()
+		return buf.Bytes()
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	for _, p := range []uint{1 << 4, 1 << 6, 1 << 10, 3, 5, 10, 44, 48, 100} {
+		for i := 0; i < 50; i++ {
+			n := uint(1 + rnd.Intn(30))
+
+			seen := make(map[uint]bool)
+			var src []uint
+			for uint(len(src)) < n {
+				v := uint(rnd.Int63n(int64(n * p)))
+				if seen[v] {
+					continue
+				}
+				seen[v] = true
+				src = append(src, v)
+			}
+			sort.Slice(src, func(i, j int) bool {
+				return src[i] < src[j]
+			})
+
+			var buf bytes.Buffer
+			if err := Encode(&buf, src, p); err != nil {
+				t.Fatal(err)
+			}
+
+			if p&(p-1) == 0 {
+				if got, want := buf.Bytes(), riceEncode(src, p); !bytes.Equal(got, want) {
+					t.Fatalf("Encode(%v, %d)=%x, want=%x", src, p, got, want)
+				}
+			}
+
+			got, err := DecodeAll(bytes.NewReader(buf.Bytes()), p)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, src) {
+				t.Fatalf("DecodeAll(Encode(%v, %d))=%v", src, p, got)
+			}
+		}
+	}
+}
+
+func TestContains(t *testing.T) {
+	input := []byte{0xcb, 0xcf} // 11001011 11001111 = {75, 154}
+	cases := []struct {
+		v    uint
+		want bool
+	}{
+		{0, false},
+		{75, true},
+		{100, false},
+		{154, true},
+		{200, false},
+	}
+
+	for _, tc := range cases {
+		got, err := Contains(bytes.NewReader(input), 1<<5, tc.v, Limits{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != tc.want {
+			t.Errorf("Contains(%d)=%v, want=%v", tc.v, got, tc.want)
+		}
+	}
+}
+
+func TestDecodeAll_Limits(t *testing.T) {
+	cases := []struct {
+		input  []byte
+		p      uint
+		limits Limits
+	}{
+		// Too many values: {75, 154}
+		{
+			[]byte{0xcb, 0xcf},
+			1 << 5,
+			Limits{MaxValues: 1},
+		},
+
+		// Out of range: {75, 154}
+		{
+			[]byte{0xcb, 0xcf},
+			1 << 5,
+			Limits{MaxValue: 154},
+		},
+
+		// Long unary code
+		{
+			[]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe, 0x00},
+			1 << 5,
+			Limits{MaxQuotient: 10},
+		},
+
+		// Unterminated unary code
+		{
+			[]byte{0xff, 0xff},
+			1 << 5,
+			Limits{},
+		},
+
+		// Not increasing: {65, 65, 104}
+		// 10000001 0000000 0100111 0 => 10000001 00000000 01001110
+		{
+			[]byte{0x81, 0x00, 0x4e},
+			1 << 6,
+			Limits{},
+		},
+
+		// Invalid parameter
+		{
+			[]byte{0x81, 0x4e},
+			0,
+			Limits{},
+		},
+	}
+
+	for _, tc := range cases {
+		_, err := AppendDecodeWithLimits(nil, bytes.NewReader(tc.input), tc.p, tc.limits)
+		if _, ok := err.(*DecodeError); !ok {
+			t.Errorf("AppendDecodeWithLimits(%x) should return *DecodeError: %v", tc.input, err)
+		}
+	}
+
+	// Limits are inclusive.
+	got, err := AppendDecodeWithLimits(nil, bytes.NewReader([]byte{0xcb, 0xcf}), 1<<5, Limits{
+		MaxValues:   2,
+		MaxQuotient: 2,
+		MaxValue:    155,
+	})
+	if err != nil {
+		t.Fatalf("AppendDecodeWithLimits should not fail: %s", err)
+	}
+
+	if want := []uint{75, 154}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("AppendDecodeWithLimits=%v, want=%v", got, want)
+	}
+}
+
+func FuzzDecodeAll(f *testing.F) {
+	f.Add([]byte{0xcb, 0x80}, uint16(1<<6))
+	f.Add([]byte{0xcb, 0xcf}, uint16(1<<5))
+	f.Add([]byte{0x81, 0x4e}, uint16(1<<6))
+	f.Add([]byte{0x8f, 0x60}, uint16(3))
+	f.Add([]byte{0xff, 0xff, 0xff, 0xfe}, uint16(1))
+
+	f.Fuzz(func(t *testing.T, input []byte, p uint16) {
+		if p == 0 {
+			return
+		}
+
+		limits := Limits{
+			MaxValues:   64,
+			MaxQuotient: 1 << 10,
+			MaxValue:    64 * uint(p),
+		}
+		got, err := AppendDecodeWithLimits(nil, bytes.NewReader(input), uint(p), limits)
+		if err != nil {
+			return
+		}
+
+		if len(got) > limits.MaxValues {
+			t.Fatalf("decoded %d values, limit is %d", len(got), limits.MaxValues)
+		}
+
+		for i, v := range got {
+			if v >= limits.MaxValue {
+				t.Fatalf("decoded value %d is out of range", v)
+			}
+
+			if i > 0 && v <= got[i-1] {
+				t.Fatalf("decoded values are not increasing: %v", got)
+			}
+		}
+
+		// Decoded values must be encoded and decoded again.
+		var buf bytes.Buffer
+		if err := Encode(&buf, got, uint(p)); err != nil {
+			t.Fatalf("Encode should not fail: %s", err)
+		}
+
+		again, err := DecodeAll(bytes.NewReader(buf.Bytes()), uint(p))
+		if err != nil {
+			t.Fatalf("DecodeAll should not fail: %s", err)
+		}
+
+		if len(got) != 0 && !reflect.DeepEqual(again, got) {
+			t.Fatalf("DecodeAll(Encode(%v))=%v", got, again)
+		}
+	})
+}
+
+func TestDecoder(t *testing.T) {
+	input := []byte{0xcb, 0xcf} // 11001011 11001111
+	dec := NewDecoder(bytes.NewReader(input), 1<<5)
+
+	for _, want := range []uint{75, 154} {
+		got, err := dec.Next()
+		if err != nil {
+			t.Fatalf("Next should not fail: %s", err)
+		}
+
+		if got != want {
+			t.Fatalf("Next=%d, want=%d", got, want)
+		}
+	}
+
+	if _, err := dec.Next(); err != io.EOF {
+		t.Fatalf("Next should return io.EOF after all values are read: %v", err)
+	}
+}
+
+func TestAppendDecode(t *testing.T) {
+	dst := make([]uint, 0, 4)
+	dst = append(dst, 1)
+
+	got, err := AppendDecode(dst, bytes.NewReader([]byte{0x81, 0x4e}), 1<<6)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []uint{1, 65, 104}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("AppendDecode=%v, want=%v", got, want)
+	}
+
+	if &got[0] != &dst[0] {
+		t.Fatalf("AppendDecode should reuse the given buffer")
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf, 1<<6)
+	for _, v := range []uint{65, 104} {
+		if err := enc.Add(v); err != nil {
+			t.Fatalf("Add should not fail: %s", err)
+		}
+	}
+
+	if err := enc.Add(100); err == nil {
+		t.Fatalf("Add should fail when the value is smaller than previous one")
+	}
+
+	if err := enc.Close(); err != nil {
+		t.Fatalf("Close should not fail: %s", err)
+	}
+
+	if got, want := buf.Bytes(), []byte{0x81, 0x4e}; !bytes.Equal(got, want) {
+		t.Errorf("Encode=%x, want=%x", got, want)
+	}
+}
+
 func ExampleEncode() {
 	// Number of elements and false positive probability.
 	//
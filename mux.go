@@ -0,0 +1,188 @@
+package casper
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Namespace is a group of assets which has its own fingerprint
+// (cookie), parameters and asset manifest. A request is assigned
+// to a namespace by its host and path.
+type Namespace struct {
+	// Name is the name of the namespace. It's used for the default
+	// cookie name ("x-go-casper-<Name>").
+	Name string
+
+	// Host is the host name of requests in the namespace. If empty,
+	// it matches any host.
+	Host string
+
+	// PathPrefix is the path prefix of requests in the namespace.
+	// If empty, it matches any path. It's also used as the default
+	// cookie path.
+	PathPrefix string
+
+	// Config is the configuration of the namespace.
+	Config Config
+}
+
+// Mux selects the casper of the namespace for each request and
+// pushes assets with it. All namespaces share the same push
+// implementation but have independent fingerprints.
+type Mux struct {
+	entries []*muxEntry
+}
+
+type muxEntry struct {
+	host       string
+	pathPrefix string
+	casper     *Casper
+}
+
+// NewMux returns a new Mux with the given namespaces.
+func NewMux(namespaces ...Namespace) (*Mux, error) {
+	if len(namespaces) == 0 {
+		return nil, errors.New("no namespace")
+	}
+
+	entries := make([]*muxEntry, 0, len(namespaces))
+	cookies := make([]muxCookie, 0, len(namespaces))
+	for _, ns := range namespaces {
+		if ns.Name == "" {
+			return nil, errors.New("namespace name must not be empty")
+		}
+
+		config := ns.Config
+		if config.CookieName == "" {
+			config.CookieName = defaultCookieName + "-" + ns.Name
+		}
+
+		if config.CookiePath == "" && ns.PathPrefix != "" {
+			config.CookiePath = ns.PathPrefix
+		}
+
+		// Namespaces must not share the same cookie. A browser sends
+		// every cookie whose path matches the request, so the same name
+		// on nested paths of the same host is a collision too.
+		cookie := muxCookie{
+			namespace: ns.Name,
+			name:      config.CookieName,
+			path:      config.CookiePath,
+			host:      strings.ToLower(ns.Host),
+		}
+		for _, other := range cookies {
+			if other.collides(cookie) {
+				return nil, fmt.Errorf("namespace %q and %q use the same cookie %q", other.namespace, ns.Name, config.CookieName)
+			}
+		}
+		cookies = append(cookies, cookie)
+
+		c, err := NewWithConfig(&config)
+		if err != nil {
+			return nil, fmt.Errorf("invalid namespace %q: %s", ns.Name, err)
+		}
+
+		entries = append(entries, &muxEntry{
+			host:       strings.ToLower(ns.Host),
+			pathPrefix: ns.PathPrefix,
+			casper:     c,
+		})
+	}
+
+	return &Mux{
+		entries: entries,
+	}, nil
+}
+
+// Casper returns the casper of the namespace for the given request.
+// Namespaces with the host are preferred to ones without it, then
+// the longest path prefix wins. It returns nil if there is no
+// namespace for the request.
+func (m *Mux) Casper(r *http.Request) *Casper {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+
+	var best *muxEntry
+	for _, e := range m.entries {
+		if e.host != "" && e.host != host {
+			continue
+		}
+
+		if !matchPathPrefix(e.pathPrefix, r.URL.Path) {
+			continue
+		}
+
+		if best == nil || e.moreSpecific(best) {
+			best = e
+		}
+	}
+
+	if best == nil {
+		return nil
+	}
+	return best.casper
+}
+
+// matchPathPrefix reports whether the path is under the prefix. The
+// prefix matches at the path segment boundary like the cookie path does,
+// i.e., "/admin" matches "/admin" and "/admin/users" but not "/administrator".
+func matchPathPrefix(prefix, path string) bool {
+	if prefix == "" || prefix == path {
+		return true
+	}
+	return strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/")
+}
+
+// muxCookie is the cookie used by a namespace.
+type muxCookie struct {
+	namespace string
+	name      string
+	path      string
+	host      string
+}
+
+// collides reports whether a browser may send the cookies of c and
+// other in the same request under the same name.
+func (c muxCookie) collides(other muxCookie) bool {
+	if c.name != other.name {
+		return false
+	}
+	if c.host != "" && other.host != "" && c.host != other.host {
+		return false
+	}
+	return matchPathPrefix(c.path, other.path) || matchPathPrefix(other.path, c.path)
+}
+
+// moreSpecific reports whether e is more specific than other.
+func (e *muxEntry) moreSpecific(other *muxEntry) bool {
+	if (e.host != "") != (other.host != "") {
+		return e.host != ""
+	}
+	return len(e.pathPrefix) > len(other.pathPrefix)
+}
+
+// Push pushes the given targets with the casper of the namespace
+// for the request. See Casper.Push.
+func (m *Mux) Push(w http.ResponseWriter, r *http.Request, targets []string, opts *Options) (*http.Request, error) {
+	c := m.Casper(r)
+	if c == nil {
+		return r, fmt.Errorf("no namespace for %s%s", r.Host, r.URL.Path)
+	}
+	return c.Push(w, r, targets, opts)
+}
+
+// PushAssets pushes the asset manifest of the namespace for
+// the request. See Casper.PushAssets.
+func (m *Mux) PushAssets(w http.ResponseWriter, r *http.Request, opts *Options) (*http.Request, error) {
+	c := m.Casper(r)
+	if c == nil {
+		return r, fmt.Errorf("no namespace for %s%s", r.Host, r.URL.Path)
+	}
+	return c.PushAssets(w, r, opts)
+}
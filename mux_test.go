@@ -0,0 +1,219 @@
+package casper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// pushRecorder is http.ResponseWriter which records pushed targets.
+type pushRecorder struct {
+	*httptest.ResponseRecorder
+	pushed []string
+}
+
+func newPushRecorder() *pushRecorder {
+	return &pushRecorder{
+		ResponseRecorder: httptest.NewRecorder(),
+	}
+}
+
+func (p *pushRecorder) Push(target string, opts *http.PushOptions) error {
+	p.pushed = append(p.pushed, target)
+	return nil
+}
+
+func testNamespaces() []Namespace {
+	return []Namespace{
+		{
+			Name: "marketing",
+			Config: Config{
+				P:      1 << 6,
+				N:      10,
+				Assets: []string{"/static/lp.css", "/static/hero.jpg"},
+			},
+		},
+		{
+			Name:       "app",
+			PathPrefix: "/app/",
+			Config: Config{
+				P:      1 << 8,
+				N:      100,
+				Assets: []string{"/app/shell.js", "/app/shell.css"},
+			},
+		},
+		{
+			Name:       "admin",
+			Host:       "admin.example.com",
+			PathPrefix: "/",
+			Config: Config{
+				P:      1 << 6,
+				N:      20,
+				Assets: []string{"/admin.js"},
+			},
+		},
+	}
+}
+
+func TestMux_Casper(t *testing.T) {
+	mux, err := NewMux(testNamespaces()...)
+	if err != nil {
+		t.Fatalf("NewMux should not fail: %s", err)
+	}
+
+	cases := []struct {
+		url        string
+		cookieName string
+		cookiePath string
+	}{
+		{"https://example.com/", "x-go-casper-marketing", "/"},
+		{"https://example.com/pricing", "x-go-casper-marketing", "/"},
+		{"https://example.com/app/", "x-go-casper-app", "/app/"},
+		{"https://example.com/app/settings", "x-go-casper-app", "/app/"},
+		{"https://admin.example.com/", "x-go-casper-admin", "/"},
+		{"https://ADMIN.example.com:8443/app/", "x-go-casper-admin", "/"},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest("GET", tc.url, nil)
+		c := mux.Casper(req)
+		if c == nil {
+			t.Fatalf("Casper(%q) should not be nil", tc.url)
+		}
+
+		if c.cookieName != tc.cookieName || c.cookiePath != tc.cookiePath {
+			t.Errorf("Casper(%q) uses cookie %s (path %s), want %s (path %s)",
+				tc.url, c.cookieName, c.cookiePath, tc.cookieName, tc.cookiePath)
+		}
+	}
+}
+
+func TestMux_Casper_PathBoundary(t *testing.T) {
+	mux, err := NewMux(
+		Namespace{Name: "default", Config: Config{P: 1 << 6, N: 10}},
+		Namespace{Name: "admin", PathPrefix: "/admin", Config: Config{P: 1 << 6, N: 10}},
+	)
+	if err != nil {
+		t.Fatalf("NewMux should not fail: %s", err)
+	}
+
+	cases := []struct {
+		path       string
+		cookieName string
+	}{
+		{"/admin", "x-go-casper-admin"},
+		{"/admin/", "x-go-casper-admin"},
+		{"/admin/users", "x-go-casper-admin"},
+		{"/administrator", "x-go-casper-default"},
+		{"/adminx/", "x-go-casper-default"},
+	}
+
+	for _, tc := range cases {
+		c := mux.Casper(httptest.NewRequest("GET", tc.path, nil))
+		if c == nil || c.cookieName != tc.cookieName {
+			t.Errorf("Casper(%q) should use cookie %s", tc.path, tc.cookieName)
+		}
+	}
+}
+
+func TestMux_PushAssets(t *testing.T) {
+	mux, err := NewMux(testNamespaces()...)
+	if err != nil {
+		t.Fatalf("NewMux should not fail: %s", err)
+	}
+
+	// Visit marketing page then app.
+	var cookies []*http.Cookie
+	for _, tc := range []struct {
+		url    string
+		pushed []string
+	}{
+		{"https://example.com/", []string{"/static/lp.css", "/static/hero.jpg"}},
+		{"https://example.com/app/", []string{"/app/shell.js", "/app/shell.css"}},
+		{"https://example.com/app/settings", nil},
+		{"https://example.com/pricing", nil},
+	} {
+		req := httptest.NewRequest("GET", tc.url, nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+
+		w := newPushRecorder()
+		if _, err := mux.PushAssets(w, req, nil); err != nil {
+			t.Fatalf("PushAssets should not fail: %s", err)
+		}
+
+		if !reflect.DeepEqual(w.pushed, tc.pushed) {
+			t.Fatalf("PushAssets(%q) pushed %v, want %v", tc.url, w.pushed, tc.pushed)
+		}
+
+		// Browser stores cookies from the responses.
+		for _, cookie := range w.Result().Cookies() {
+			cookies = replaceCookie(cookies, cookie)
+		}
+	}
+
+	if got, want := len(cookies), 2; got != want {
+		t.Fatalf("number of cookies %d, want %d", got, want)
+	}
+}
+
+func replaceCookie(cookies []*http.Cookie, cookie *http.Cookie) []*http.Cookie {
+	for i, c := range cookies {
+		if c.Name == cookie.Name {
+			cookies[i] = cookie
+			return cookies
+		}
+	}
+	return append(cookies, cookie)
+}
+
+func TestNewMux_SameCookieName(t *testing.T) {
+	cases := [][]Namespace{
+		{
+			{Name: "a", PathPrefix: "/app", Config: Config{P: 1 << 6, N: 10, CookieName: "same"}},
+			{Name: "b", PathPrefix: "/application", Config: Config{P: 1 << 6, N: 10, CookieName: "same"}},
+		},
+		{
+			{Name: "a", Host: "a.example.com", Config: Config{P: 1 << 6, N: 10, CookieName: "same"}},
+			{Name: "b", Host: "b.example.com", Config: Config{P: 1 << 6, N: 10, CookieName: "same"}},
+		},
+	}
+
+	for _, namespaces := range cases {
+		if _, err := NewMux(namespaces...); err != nil {
+			t.Errorf("NewMux(%v) should not fail: %s", namespaces, err)
+		}
+	}
+}
+
+func TestNewMux_Invalid(t *testing.T) {
+	cases := [][]Namespace{
+		nil,
+		{
+			{Name: "", Config: Config{P: 1 << 6, N: 10}},
+		},
+		{
+			{Name: "a", Config: Config{P: 1 << 6, N: 10, CookieName: "same"}},
+			{Name: "b", Config: Config{P: 1 << 6, N: 10, CookieName: "same"}},
+		},
+		{
+			{Name: "a", PathPrefix: "/", Config: Config{P: 1 << 6, N: 10, CookieName: "same"}},
+			{Name: "b", PathPrefix: "/app", Config: Config{P: 1 << 6, N: 10, CookieName: "same"}},
+		},
+		{
+			{Name: "a", Host: "example.com", PathPrefix: "/app/", Config: Config{P: 1 << 6, N: 10, CookieName: "same"}},
+			{Name: "b", PathPrefix: "/app/admin", Config: Config{P: 1 << 6, N: 10, CookieName: "same"}},
+		},
+		{
+			{Name: "a", Config: Config{P: 0, N: 10}},
+		},
+	}
+
+	for _, namespaces := range cases {
+		if _, err := NewMux(namespaces...); err == nil {
+			t.Errorf("NewMux(%v) should fail", namespaces)
+		}
+	}
+}
@@ -0,0 +1,430 @@
+package casper_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	casper "github.com/tcnksm/go-casper"
+	"github.com/tcnksm/go-casper/caspertest"
+)
+
+func TestPush(t *testing.T) {
+	cases := []struct {
+		p        int
+		push     []string
+		sameTime bool
+
+		clientCookie *http.Cookie
+		serverCookie *http.Cookie
+
+		casperCookie *http.Cookie
+		pushed       []string
+	}{
+		{
+			1 << 6,
+			[]string{"/static/example.jpg"},
+			false,
+			nil,
+			nil,
+
+			&http.Cookie{
+				Name:  casper.DefaultCookieName,
+				Value: "KA",
+				Path:  casper.DefaultCookiePath,
+			},
+			[]string{"/static/example.jpg"},
+		},
+
+		{
+			1 << 6,
+			[]string{"/static/example.jpg"},
+			true, // push one by one
+			nil,
+			nil,
+
+			&http.Cookie{
+				Name:  casper.DefaultCookieName,
+				Value: "KA",
+				Path:  casper.DefaultCookiePath,
+			},
+			[]string{"/static/example.jpg"},
+		},
+
+		{
+			1 << 6,
+			[]string{
+				"/js/jquery-1.9.1.min.js",
+				"/assets/style.css",
+				"/static/logo.jpg",
+				"/static/cover.jpg",
+			},
+			false,
+			nil,
+			nil,
+
+			&http.Cookie{
+				Name:  casper.DefaultCookieName,
+				Value: "gU54MA",
+				Path:  casper.DefaultCookiePath,
+			},
+			[]string{
+				"/js/jquery-1.9.1.min.js",
+				"/assets/style.css",
+				"/static/logo.jpg",
+				"/static/cover.jpg",
+			},
+		},
+
+		// With additional server side cookies
+		{
+			1 << 6,
+			[]string{"/static/example.jpg"},
+			false,
+			nil,
+			&http.Cookie{
+				Name:  "session",
+				Value: "BAh7CiIKZmxhc2hJ",
+				Path:  "/",
+			},
+
+			&http.Cookie{
+				Name:  casper.DefaultCookieName,
+				Value: "KA",
+				Path:  casper.DefaultCookiePath,
+			},
+			[]string{"/static/example.jpg"},
+		},
+
+		// With client side cookies
+		{
+			1 << 6,
+			[]string{
+				"/js/jquery-1.9.1.min.js",
+				"/assets/style.css",
+				"/static/logo.jpg",
+				"/static/cover.jpg",
+			},
+			false,
+
+			// This cookie is generated by /js/jquery-1.9.1.min.js and /assets/style.css
+			// This means these are already pushed on previous request and should not
+			// be pushed this time.
+			&http.Cookie{
+				Name:  casper.DefaultCookieName,
+				Value: "gU4",
+			},
+			nil,
+
+			&http.Cookie{
+				Name:  casper.DefaultCookieName,
+				Value: "gU54MA",
+				Path:  casper.DefaultCookiePath,
+			},
+			[]string{
+				"/static/logo.jpg",
+				"/static/cover.jpg",
+			},
+		},
+
+		{
+			1 << 6,
+			[]string{
+				"/js/jquery-1.9.1.min.js",
+				"/assets/style.css",
+				"/static/logo.jpg",
+				"/static/cover.jpg",
+			},
+			true, // push one by one
+
+			// This cookie is generated by /js/jquery-1.9.1.min.js and /assets/style.css
+			// This means these are already pushed on previous request and should not
+			// be pushed this time.
+			&http.Cookie{
+				Name:  casper.DefaultCookieName,
+				Value: "gU4",
+			},
+			nil,
+
+			&http.Cookie{
+				Name:  casper.DefaultCookieName,
+				Value: "gU54MA",
+				Path:  casper.DefaultCookiePath,
+			},
+			[]string{
+				"/static/logo.jpg",
+				"/static/cover.jpg",
+			},
+		},
+
+		// With server and client cookies
+		{
+			1 << 6,
+			[]string{
+				"/js/jquery-1.9.1.min.js",
+				"/assets/style.css",
+				"/static/logo.jpg",
+				"/static/cover.jpg",
+			},
+			false,
+
+			// This cookie is generated by /js/jquery-1.9.1.min.js and /assets/style.css
+			// This means these are already pushed on previous request and should not
+			// be pushed this time.
+			&http.Cookie{
+				Name:  casper.DefaultCookieName,
+				Value: "gU4",
+			},
+
+			&http.Cookie{
+				Name:  "session",
+				Value: "BAh7CiIKZmxhc2hJ",
+				Path:  "/",
+			},
+
+			&http.Cookie{
+				Name:  casper.DefaultCookieName,
+				Value: "gU54MA",
+				Path:  casper.DefaultCookiePath,
+			},
+			[]string{
+				"/static/logo.jpg",
+				"/static/cover.jpg",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		pusher := casper.New(tc.p, len(tc.push))
+		handler := newTestHandler(t, pusher, tc.push, tc.sameTime, tc.serverCookie)
+
+		req := httptest.NewRequest("GET", "/", nil)
+
+		// Values in the table are golomb-coded part of cookie.
+		if tc.clientCookie != nil {
+			tc.clientCookie.Value = casper.CookieValue(pusher, tc.clientCookie.Value)
+			req.AddCookie(tc.clientCookie)
+		}
+		tc.casperCookie.Value = casper.CookieValue(pusher, tc.casperCookie.Value)
+
+		rec := caspertest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		// Inspect pushed contents
+		if got, want := rec.Pushed(), tc.pushed; !reflect.DeepEqual(got, want) {
+			t.Fatalf("pushed contents %v, want %v", got, want)
+		}
+
+		// Inspect cookies to be returned from server.
+		wantCookie := 1
+		if tc.serverCookie != nil {
+			wantCookie = 2
+		}
+
+		cookies := rec.Result().Cookies()
+		if got, want := len(cookies), wantCookie; got != want {
+			t.Fatalf("Number of cookie %d, want %d", got, want)
+		}
+
+		tc.casperCookie.Raw = tc.casperCookie.String() // Need to set Raw to compare
+		if got, want := cookies[wantCookie-1], tc.casperCookie; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Get cookie name %#v, want %#v", got, want)
+		}
+	}
+}
+
+func newTestHandler(t *testing.T, c *casper.Casper, contents []string, sameTime bool, cookie *http.Cookie) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		// Set additinal cookie if provided.
+		if cookie != nil {
+			http.SetCookie(w, cookie)
+		}
+
+		if sameTime {
+			// Push all contents at same time
+			if _, err := c.Push(w, r, contents, nil); err != nil {
+				t.Fatalf("Push failed: %s", err)
+			}
+		} else {
+			// Push contents one by one. Test for context.
+			for _, content := range contents {
+				var err error
+				r, err = c.Push(w, r, []string{content}, nil)
+				if err != nil {
+					t.Fatalf("Push failed: %s", err)
+				}
+			}
+		}
+
+		w.Header().Add("Content-Type", "text/html")
+		w.Write([]byte(""))
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func TestPush_Caspertest(t *testing.T) {
+	pusher := casper.New(1<<6, 10)
+	handler := newTestHandler(t, pusher, []string{"/static/app.js", "/static/app.css"}, true, nil)
+
+	// First visit.
+	rec := caspertest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	caspertest.AssertPushed(t, rec, "/static/app.js", "/static/app.css")
+
+	// Second visit with the cookie.
+	next := caspertest.NewRecorder()
+	handler.ServeHTTP(next, caspertest.NextRequest("GET", "/", rec))
+	caspertest.AssertNotPushed(t, next)
+
+	// The client has only app.css.
+	rec = caspertest.NewRecorder()
+	handler.ServeHTTP(rec, caspertest.NewRequest("GET", "/", pusher, "/static/app.css"))
+	caspertest.AssertPushed(t, rec, "/static/app.js")
+	caspertest.AssertNotPushed(t, rec, "/static/app.css")
+}
+
+func newTestAssetHandler(t *testing.T, c *casper.Casper, contents []string, pushErr *error) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		_, err := c.Push(w, r, contents, nil)
+		if pushErr != nil {
+			*pushErr = err
+		} else if err != nil {
+			t.Errorf("Push failed: %s", err)
+		}
+
+		w.Header().Add("Content-Type", "text/html")
+		w.Write([]byte("<html></html>"))
+	})
+	mux.HandleFunc("/static/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "text/plain")
+		w.Write([]byte("content of " + r.URL.Path))
+	})
+	return mux
+}
+
+func TestPush_HTTP2(t *testing.T) {
+	contents := []string{"/static/app.js", "/static/app.css", "/static/logo.jpg"}
+	ts := caspertest.NewServer(newTestAssetHandler(t, casper.New(1<<6, 10), contents, nil))
+	defer ts.Close()
+
+	client, err := caspertest.NewClient(ts, nil)
+	if err != nil {
+		t.Fatalf("NewClient should not fail: %s", err)
+	}
+	defer client.Close()
+
+	// First visit. All contents are pushed in order.
+	res, err := client.Get("/")
+	if err != nil {
+		t.Fatalf("Get should not fail: %s", err)
+	}
+
+	if got, want := res.StatusCode, http.StatusOK; got != want {
+		t.Fatalf("status code %d, want %d", got, want)
+	}
+
+	if got, want := res.Pushed(), contents; !reflect.DeepEqual(got, want) {
+		t.Fatalf("pushed %v, want %v", got, want)
+	}
+
+	for _, push := range res.Pushes {
+		if push.Method != "GET" {
+			t.Errorf("pushed %s with method %s, want GET", push.Path, push.Method)
+		}
+
+		if push.StatusCode != http.StatusOK || string(push.Body) != "content of "+push.Path {
+			t.Errorf("unexpected pushed response for %s: %d %q", push.Path, push.StatusCode, push.Body)
+		}
+	}
+
+	// Second visit. Nothing is pushed.
+	res, err = client.Get("/")
+	if err != nil {
+		t.Fatalf("Get should not fail: %s", err)
+	}
+
+	if len(res.Pushes) != 0 {
+		t.Fatalf("nothing should be pushed: %v", res.Pushed())
+	}
+}
+
+func TestPush_StdlibPushLimit(t *testing.T) {
+	c := casper.New(1<<6, 10)
+	contents := []string{"/static/a.js", "/static/b.js", "/static/c.js"}
+
+	// Pushed streams are kept open until the pushes end.
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		r, err := c.Push(w, r, contents, nil)
+		close(release)
+		if err != nil {
+			t.Errorf("Push failed: %s", err)
+			return
+		}
+
+		for i, result := range c.Results(r) {
+			if want := casper.PushStatusBudget; i > 0 && result.Status != want {
+				t.Errorf("%s is %s, want %s", result.Target, result.Status, want)
+			}
+		}
+	})
+	mux.HandleFunc("/static/", func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte("content of " + r.URL.Path))
+	})
+
+	// The HTTP/2 server bundled in net/http.
+	ts := httptest.NewUnstartedServer(mux)
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	client, err := caspertest.NewClient(ts, &caspertest.ClientOptions{MaxConcurrentStreams: 1})
+	if err != nil {
+		t.Fatalf("NewClient should not fail: %s", err)
+	}
+	defer client.Close()
+
+	res, err := client.Get("/")
+	if err != nil {
+		t.Fatalf("Get should not fail: %s", err)
+	}
+
+	if got, want := res.Pushed(), contents[:1]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("pushed %v, want %v", got, want)
+	}
+
+	cookie, _ := c.GenerateCookie(contents[:1])
+	if got := res.Header.Get("Set-Cookie"); got != cookie.String() {
+		t.Fatalf("Set-Cookie %q, want %q", got, cookie.String())
+	}
+}
+
+func TestPush_HTTP2PushDisabled(t *testing.T) {
+	var pushErr error
+	ts := caspertest.NewServer(newTestAssetHandler(t, casper.New(1<<6, 10), []string{"/static/app.js"}, &pushErr))
+	defer ts.Close()
+
+	client, err := caspertest.NewClient(ts, &caspertest.ClientOptions{DisablePush: true})
+	if err != nil {
+		t.Fatalf("NewClient should not fail: %s", err)
+	}
+	defer client.Close()
+
+	res, err := client.Get("/")
+	if err != nil {
+		t.Fatalf("Get should not fail: %s", err)
+	}
+
+	if pushErr != http.ErrNotSupported {
+		t.Fatalf("Push should return ErrNotSupported: %v", pushErr)
+	}
+
+	if len(res.Pushes) != 0 {
+		t.Fatalf("nothing should be pushed: %v", res.Pushed())
+	}
+}
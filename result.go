@@ -0,0 +1,155 @@
+package casper
+
+import (
+	"context"
+	"net/http"
+)
+
+// PushStatus is the status of a target after Push.
+type PushStatus int
+
+const (
+	// PushStatusPushed means the target is pushed.
+	PushStatusPushed PushStatus = iota
+
+	// PushStatusCached means the target is not pushed since the
+	// fingerprint claims the client has it.
+	PushStatusCached
+
+	// PushStatusConnection means the target is not pushed since it's
+	// already pushed on the connection (see ConnContext).
+	PushStatusConnection
+
+	// PushStatusBudget means the target is not pushed since the push
+	// budget of the request or the connection runs out.
+	PushStatusBudget
+
+	// PushStatusEvicted means the entry is evicted from the
+	// fingerprint since it's full (see EvictionPolicy).
+	PushStatusEvicted
+)
+
+// String returns the description of the status.
+func (s PushStatus) String() string {
+	switch s {
+	case PushStatusPushed:
+		return "pushed"
+	case PushStatusCached:
+		return "skipped: cached"
+	case PushStatusConnection:
+		return "skipped: connection"
+	case PushStatusBudget:
+		return "skipped: budget"
+	case PushStatusEvicted:
+		return "evicted"
+	default:
+		return "unknown"
+	}
+}
+
+// PushResult is the result of Push for a target or an evicted
+// fingerprint entry.
+type PushResult struct {
+	// Target is empty for the evicted entry which is
+	// not one of the current assets.
+	Target string
+	Status PushStatus
+
+	// Hash is the fingerprint entry of the target.
+	Hash uint
+
+	// Size is the size of the target in bytes. It's zero
+	// if the size is unknown.
+	Size int64
+}
+
+// Results returns the results of all calls to Push for the request. The
+// request must be the one returned by Push. The results are in the order
+// of the calls and the targets, followed by the entries evicted by
+// each call.
+func (c *Casper) Results(r *http.Request) []PushResult {
+	return c.contextResults(r.Context())
+}
+
+func (c *Casper) withResults(parent context.Context, results []PushResult) context.Context {
+	return context.WithValue(parent, c.resultsContextKey, results)
+}
+
+func (c *Casper) contextResults(ctx context.Context) []PushResult {
+	results, _ := ctx.Value(c.resultsContextKey).([]PushResult)
+	return results
+}
+
+// pushBudget is the push budget of a request.
+type pushBudget struct {
+	maxCount int
+	maxBytes int64
+
+	count int
+	bytes int64
+
+	// exhausted is set when a target does not fit the budget,
+	// so the lower priority targets are not pushed either.
+	exhausted bool
+}
+
+// newPushBudget returns the budget of the request which has
+// already pushed the targets of the previous results. The limit
+// of the server (see ServerOptions) applies if it's lower.
+func (c *Casper) newPushBudget(ctx context.Context, results []PushResult) *pushBudget {
+	b := &pushBudget{
+		maxCount: c.maxPushes,
+		maxBytes: c.maxPushBytes,
+	}
+
+	if max := contextMaxPushes(ctx); max > 0 && (b.maxCount == 0 || max < b.maxCount) {
+		b.maxCount = max
+	}
+
+	for _, result := range results {
+		if result.Status == PushStatusPushed {
+			b.count++
+			b.bytes += result.Size
+		}
+	}
+	return b
+}
+
+// reserve reports whether the target of the size fits the budget.
+func (b *pushBudget) reserve(size int64) bool {
+	if b.exhausted {
+		return false
+	}
+
+	if (b.maxCount > 0 && b.count+1 > b.maxCount) || (b.maxBytes > 0 && b.bytes+size > b.maxBytes) {
+		b.exhausted = true
+		return false
+	}
+
+	b.count++
+	b.bytes += size
+	return true
+}
+
+// release releases the target which was not pushed.
+func (b *pushBudget) release(size int64) {
+	b.count--
+	b.bytes -= size
+}
+
+// assetSize returns the size of the target from the catalog or
+// the manifest. It returns zero if the size is unknown.
+func (c *Casper) assetSize(target string) int64 {
+	if c.catalog != nil {
+		if asset, ok := c.catalog.Lookup(target); ok {
+			return asset.Size
+		}
+	}
+
+	if c.manifest != nil {
+		if size, ok := c.manifest.Size(target); ok {
+			return size
+		}
+	}
+	return 0
+}
@@ -0,0 +1,158 @@
+package casper
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestPush_Budget(t *testing.T) {
+	catalog, err := NewCatalog(testFS(), "/static/")
+	if err != nil {
+		t.Fatalf("NewCatalog should not fail: %s", err)
+	}
+
+	// app.js is 22 bytes, style.css is 19 bytes and example.jpg is 3 bytes.
+	targets := []string{"/static/app.js", "/static/style.css", "/static/img/example.jpg"}
+
+	cases := []struct {
+		config   Config
+		pushed   []string
+		statuses []PushStatus
+	}{
+		{
+			config:   Config{},
+			pushed:   targets,
+			statuses: []PushStatus{PushStatusPushed, PushStatusPushed, PushStatusPushed},
+		},
+		{
+			config:   Config{MaxPushes: 1},
+			pushed:   targets[:1],
+			statuses: []PushStatus{PushStatusPushed, PushStatusBudget, PushStatusBudget},
+		},
+		{
+			// The lower priority targets are not pushed
+			// even if they fit the budget.
+			config:   Config{MaxPushBytes: 30},
+			pushed:   targets[:1],
+			statuses: []PushStatus{PushStatusPushed, PushStatusBudget, PushStatusBudget},
+		},
+		{
+			config:   Config{MaxPushBytes: 41},
+			pushed:   targets[:2],
+			statuses: []PushStatus{PushStatusPushed, PushStatusPushed, PushStatusBudget},
+		},
+	}
+
+	for i, tc := range cases {
+		tc.config.P, tc.config.N = 1<<6, 10
+		tc.config.Catalog = catalog
+		c, err := NewWithConfig(&tc.config)
+		if err != nil {
+			t.Fatalf("#%d NewWithConfig should not fail: %s", i, err)
+		}
+
+		w := newPushRecorder()
+		r, err := c.Push(w, httptest.NewRequest("GET", "/", nil), targets, nil)
+		if err != nil {
+			t.Fatalf("#%d Push should not fail: %s", i, err)
+		}
+
+		if !reflect.DeepEqual(w.pushed, tc.pushed) {
+			t.Fatalf("#%d pushed %v, want %v", i, w.pushed, tc.pushed)
+		}
+
+		results := c.Results(r)
+		if len(results) != len(targets) {
+			t.Fatalf("#%d number of results %d, want %d", i, len(results), len(targets))
+		}
+
+		for j, result := range results {
+			if result.Target != targets[j] || result.Status != tc.statuses[j] {
+				t.Fatalf("#%d result %v, want %s %s", i, result, targets[j], tc.statuses[j])
+			}
+		}
+	}
+}
+
+func TestPush_BudgetPerRequest(t *testing.T) {
+	c, err := NewWithConfig(&Config{P: 1 << 6, N: 10, MaxPushes: 2})
+	if err != nil {
+		t.Fatalf("NewWithConfig should not fail: %s", err)
+	}
+
+	w := newPushRecorder()
+	r, err := c.Push(w, httptest.NewRequest("GET", "/", nil), []string{"/static/app.js"}, nil)
+	if err != nil {
+		t.Fatalf("Push should not fail: %s", err)
+	}
+
+	// The second call shares the budget with the first one.
+	r, err = c.Push(w, r, []string{"/static/app.js", "/static/app.css", "/static/img.jpg"}, nil)
+	if err != nil {
+		t.Fatalf("Push should not fail: %s", err)
+	}
+
+	if got, want := w.pushed, []string{"/static/app.js", "/static/app.css"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("pushed %v, want %v", got, want)
+	}
+
+	var statuses []string
+	for _, result := range c.Results(r) {
+		statuses = append(statuses, result.Status.String())
+	}
+
+	want := []string{"pushed", "skipped: cached", "pushed", "skipped: budget"}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Fatalf("statuses %v, want %v", statuses, want)
+	}
+}
+
+func TestPush_ConnBudget(t *testing.T) {
+	conn, other := net.Pipe()
+	defer conn.Close()
+	defer other.Close()
+	defer ConnState(conn, http.StateClosed)
+
+	catalog, err := NewCatalog(testFS(), "/static/")
+	if err != nil {
+		t.Fatalf("NewCatalog should not fail: %s", err)
+	}
+
+	c, err := NewWithConfig(&Config{P: 1 << 6, N: 10, Catalog: catalog, MaxConnPushBytes: 25})
+	if err != nil {
+		t.Fatalf("NewWithConfig should not fail: %s", err)
+	}
+
+	ctx := ConnContext(httptest.NewRequest("GET", "/", nil).Context(), conn)
+
+	first := newPushRecorder()
+	if _, err := c.Push(first, httptest.NewRequest("GET", "/", nil).WithContext(ctx), []string{"/static/app.js"}, nil); err != nil {
+		t.Fatalf("Push should not fail: %s", err)
+	}
+
+	// The connection has room only for example.jpg, but it has
+	// lower priority than style.css.
+	second := newPushRecorder()
+	r, err := c.Push(second, httptest.NewRequest("GET", "/other", nil).WithContext(ctx), []string{
+		"/static/app.js", "/static/style.css", "/static/img/example.jpg",
+	}, nil)
+	if err != nil {
+		t.Fatalf("Push should not fail: %s", err)
+	}
+
+	if len(second.pushed) != 0 {
+		t.Fatalf("pushed %v, want nothing", second.pushed)
+	}
+
+	want := []PushResult{
+		{Target: "/static/app.js", Status: PushStatusConnection, Hash: c.hashTarget("/static/app.js"), Size: 22},
+		{Target: "/static/style.css", Status: PushStatusBudget, Hash: c.hashTarget("/static/style.css"), Size: 19},
+		{Target: "/static/img/example.jpg", Status: PushStatusBudget, Hash: c.hashTarget("/static/img/example.jpg"), Size: 3},
+	}
+	if got := c.Results(r); !reflect.DeepEqual(got, want) {
+		t.Fatalf("results %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,329 @@
+package casper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// ServerOptions includes options for ConfigureServer.
+type ServerOptions struct {
+	// MaxConcurrentStreams is the maximum number of concurrent streams
+	// opened by the client per connection. If zero, the default of
+	// golang.org/x/net/http2 (250) is used.
+	//
+	// If non-zero, it also caps the pushes of each request like
+	// Config.MaxPushes (the lower one applies). Pushes are also limited
+	// by the client's SETTINGS_MAX_CONCURRENT_STREAMS. The targets over
+	// either limit are reported as PushStatusBudget (see Results).
+	MaxConcurrentStreams uint32
+
+	// DisablePush disables server push for requests served by the
+	// server. Push does nothing (it does not push nor record targets)
+	// and returns no error.
+	DisablePush bool
+
+	// H2C enables HTTP/2 over cleartext TCP (h2c), e.g., behind a
+	// TLS-terminating proxy. Both prior knowledge and HTTP/1.1 requests
+	// with "Upgrade: h2c" are supported. Upgrade requests with a body
+	// are served by HTTP/1.1 without upgrade.
+	H2C bool
+}
+
+// pushDisabledContextKey is used for disabling Push for requests
+// served by the server configured with ServerOptions.DisablePush.
+var pushDisabledContextKey = &contextKey{"casper-push-disabled"}
+
+// maxPushesContextKey is used for limiting the pushes of requests
+// served by the server configured with ServerOptions.MaxConcurrentStreams.
+var maxPushesContextKey = &contextKey{"casper-max-pushes"}
+
+// ConfigureServer configures srv to serve HTTP/2 by golang.org/x/net/http2
+// with the push-related settings. It must be called before srv starts
+// serving. The settings apply to all caspers used by the handler of srv.
+//
+// HTTP/2 over TLS is always enabled. With ServerOptions.H2C, srv also
+// serves HTTP/2 over cleartext TCP. Pushes are deduplicated on each
+// connection (see ConnContext).
+func ConfigureServer(srv *http.Server, opts *ServerOptions) error {
+	if opts == nil {
+		opts = &ServerOptions{}
+	}
+
+	h2s := &http2.Server{
+		MaxConcurrentStreams: opts.MaxConcurrentStreams,
+	}
+	if err := http2.ConfigureServer(srv, h2s); err != nil {
+		return err
+	}
+
+	// The HTTP/2 server does not inherit the connection context.
+	if next, ok := srv.TLSNextProto[http2.NextProtoTLS]; ok {
+		srv.TLSNextProto[http2.NextProtoTLS] = func(hs *http.Server, conn *tls.Conn, h http.Handler) {
+			next(hs, conn, withConnPushes(h, registeredConnPushes(conn)))
+		}
+	}
+
+	// Deduplicate pushes on each connection.
+	connContext, connState := srv.ConnContext, srv.ConnState
+	srv.ConnContext = func(ctx context.Context, conn net.Conn) context.Context {
+		if connContext != nil {
+			ctx = connContext(ctx, conn)
+		}
+		return ConnContext(ctx, conn)
+	}
+	srv.ConnState = func(conn net.Conn, state http.ConnState) {
+		ConnState(conn, state)
+		if connState != nil {
+			connState(conn, state)
+		}
+	}
+
+	handler := srv.Handler
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+
+	if opts.DisablePush {
+		next := handler
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), pushDisabledContextKey, true)))
+		})
+	}
+
+	if opts.MaxConcurrentStreams != 0 {
+		next, max := handler, int(opts.MaxConcurrentStreams)
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), maxPushesContextKey, max)))
+		})
+	}
+
+	if opts.H2C {
+		handler = &h2cHandler{
+			handler: handler,
+			server:  h2s,
+			base:    srv,
+		}
+	}
+
+	if handler != http.DefaultServeMux {
+		srv.Handler = handler
+	}
+	return nil
+}
+
+// contextPushDisabled reports whether Push is disabled for
+// the request of the context.
+func contextPushDisabled(ctx context.Context) bool {
+	disabled, _ := ctx.Value(pushDisabledContextKey).(bool)
+	return disabled
+}
+
+// contextMaxPushes returns the maximum number of pushes for
+// the request of the context. It returns zero if unlimited.
+func contextMaxPushes(ctx context.Context) int {
+	max, _ := ctx.Value(maxPushesContextKey).(int)
+	return max
+}
+
+// h2cHandler serves HTTP/2 connections over cleartext TCP. Other
+// requests are passed to the handler.
+//
+// Go's HTTP/1 server passes the client connection preface ("PRI *
+// HTTP/2.0") to the handler as a request, so the connection can be
+// hijacked and served by the HTTP/2 server. Upgrade requests are
+// converted to the frames of stream 1 and served by the HTTP/2 server
+// in the same way.
+type h2cHandler struct {
+	handler http.Handler
+	server  *http2.Server
+	base    *http.Server
+}
+
+func (h *h2cHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "PRI" && r.RequestURI == "*" && r.Proto == "HTTP/2.0" {
+		h.servePriorKnowledge(w, r)
+		return
+	}
+
+	if isH2CUpgrade(r) {
+		if upgrade, ok := upgradeFrames(r); ok {
+			h.serveUpgrade(w, r, upgrade)
+			return
+		}
+	}
+
+	h.handler.ServeHTTP(w, r)
+}
+
+func (h *h2cHandler) servePriorKnowledge(w http.ResponseWriter, r *http.Request) {
+	conn, rw, ok := hijack(w)
+	if !ok {
+		return
+	}
+
+	// The HTTP/1 server has read the preface until the empty line.
+	// The rest of it must follow.
+	const rest = "SM\r\n\r\n"
+	buf := make([]byte, len(rest))
+	if _, err := io.ReadFull(rw, buf); err != nil || string(buf) != rest {
+		conn.Close()
+		return
+	}
+
+	// The HTTP/2 server reads the whole preface again.
+	h.serveConn(r, conn, io.MultiReader(strings.NewReader(http2.ClientPreface), rw))
+}
+
+func (h *h2cHandler) serveUpgrade(w http.ResponseWriter, r *http.Request, upgrade []byte) {
+	conn, rw, ok := hijack(w)
+	if !ok {
+		return
+	}
+
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: h2c\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return
+	}
+
+	// The client sends the preface after the 101 response. The HTTP/2
+	// server reads the converted request before the rest of it.
+	buf := make([]byte, len(http2.ClientPreface))
+	if _, err := io.ReadFull(rw, buf); err != nil || string(buf) != http2.ClientPreface {
+		conn.Close()
+		return
+	}
+
+	h.serveConn(r, conn, io.MultiReader(bytes.NewReader(upgrade), rw))
+}
+
+func (h *h2cHandler) serveConn(r *http.Request, conn net.Conn, reader io.Reader) {
+	h.server.ServeConn(&h2cConn{Conn: conn, r: reader}, &http2.ServeConnOpts{
+		BaseConfig: h.base,
+		Handler:    withConnPushes(h.handler, contextConnPushes(r.Context())),
+	})
+}
+
+// hijack hijacks the connection. It responds with an error
+// if the connection can't be hijacked.
+func hijack(w http.ResponseWriter) (net.Conn, *bufio.ReadWriter, bool) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "h2c is not supported", http.StatusHTTPVersionNotSupported)
+		return nil, nil, false
+	}
+
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		http.Error(w, "h2c is not supported", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	return conn, rw, true
+}
+
+// isH2CUpgrade reports whether r is a HTTP/1.1 request
+// to upgrade to h2c.
+func isH2CUpgrade(r *http.Request) bool {
+	return r.ProtoMajor == 1 &&
+		headerHasToken(r.Header, "Connection", "upgrade") &&
+		headerHasToken(r.Header, "Connection", "http2-settings") &&
+		headerHasToken(r.Header, "Upgrade", "h2c") &&
+		len(r.Header["Http2-Settings"]) == 1
+}
+
+// upgradeFrames converts the upgrade request to the client connection
+// preface, the SETTINGS frame of HTTP2-Settings and the HEADERS frame of
+// stream 1. It returns false if the request can't be converted (e.g., it
+// has a body).
+func upgradeFrames(r *http.Request) ([]byte, bool) {
+	if r.ContentLength != 0 || len(r.TransferEncoding) != 0 {
+		return nil, false
+	}
+
+	settings, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(r.Header.Get("HTTP2-Settings"), "="))
+	if err != nil || len(settings)%6 != 0 {
+		return nil, false
+	}
+
+	var block bytes.Buffer
+	enc := hpack.NewEncoder(&block)
+	enc.WriteField(hpack.HeaderField{Name: ":method", Value: r.Method})
+	enc.WriteField(hpack.HeaderField{Name: ":scheme", Value: "http"})
+	enc.WriteField(hpack.HeaderField{Name: ":authority", Value: r.Host})
+	enc.WriteField(hpack.HeaderField{Name: ":path", Value: r.RequestURI})
+	for k, vs := range r.Header {
+		if isConnectionHeader(r.Header, k) {
+			continue
+		}
+
+		for _, v := range vs {
+			enc.WriteField(hpack.HeaderField{Name: strings.ToLower(k), Value: v})
+		}
+	}
+
+	// CONTINUATION frames are not supported.
+	if block.Len() > 16384 {
+		return nil, false
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(http2.ClientPreface)
+	framer := http2.NewFramer(&buf, nil)
+	if err := framer.WriteRawFrame(http2.FrameSettings, 0, 0, settings); err != nil {
+		return nil, false
+	}
+
+	if err := framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      1,
+		BlockFragment: block.Bytes(),
+		EndStream:     true,
+		EndHeaders:    true,
+	}); err != nil {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+// isConnectionHeader reports whether the header is specific to the
+// HTTP/1.1 connection, which is not allowed in HTTP/2.
+func isConnectionHeader(h http.Header, key string) bool {
+	switch key {
+	case "Connection", "Upgrade", "Http2-Settings", "Keep-Alive", "Proxy-Connection", "Transfer-Encoding", "Host":
+		return true
+	}
+	return headerHasToken(h, "Connection", key)
+}
+
+// headerHasToken reports whether the comma-separated header values
+// include the token (case-insensitive).
+func headerHasToken(h http.Header, key, token string) bool {
+	for _, v := range h[key] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// h2cConn is a hijacked connection which reads the buffered
+// data first.
+type h2cConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *h2cConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
@@ -0,0 +1,325 @@
+package casper_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	casper "github.com/tcnksm/go-casper"
+	"github.com/tcnksm/go-casper/caspertest"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+func newH2CServer(t *testing.T, c *casper.Casper, contents []string, opts *casper.ServerOptions) *httptest.Server {
+	ts := httptest.NewUnstartedServer(newTestAssetHandler(t, c, contents, nil))
+	if err := casper.ConfigureServer(ts.Config, opts); err != nil {
+		t.Fatalf("ConfigureServer should not fail: %s", err)
+	}
+	ts.Start()
+	return ts
+}
+
+func TestConfigureServer_H2C(t *testing.T) {
+	contents := []string{"/static/app.js", "/static/app.css"}
+	ts := newH2CServer(t, casper.New(1<<6, 10), contents, &casper.ServerOptions{H2C: true})
+	defer ts.Close()
+
+	client, err := caspertest.NewClient(ts, &caspertest.ClientOptions{H2C: true})
+	if err != nil {
+		t.Fatalf("NewClient should not fail: %s", err)
+	}
+	defer client.Close()
+
+	res, err := client.Get("/")
+	if err != nil {
+		t.Fatalf("Get should not fail: %s", err)
+	}
+
+	if got, want := res.Pushed(), contents; !reflect.DeepEqual(got, want) {
+		t.Fatalf("pushed %v, want %v", got, want)
+	}
+
+	for _, push := range res.Pushes {
+		if got, want := string(push.Body), "content of "+push.Path; got != want {
+			t.Fatalf("pushed body %q, want %q", got, want)
+		}
+	}
+
+	// HTTP/1.1 is still served.
+	res1, err := http.Get(ts.URL + "/static/app.js")
+	if err != nil {
+		t.Fatalf("HTTP/1.1 request should not fail: %s", err)
+	}
+	res1.Body.Close()
+
+	if res1.StatusCode != http.StatusOK || res1.ProtoMajor != 1 {
+		t.Fatalf("unexpected response: %s %d", res1.Proto, res1.StatusCode)
+	}
+
+	// Upgrade with body is served by HTTP/1.1.
+	req, _ := http.NewRequest("POST", ts.URL+"/static/app.js", strings.NewReader("body"))
+	req.Header.Set("Connection", "Upgrade, HTTP2-Settings")
+	req.Header.Set("Upgrade", "h2c")
+	req.Header.Set("HTTP2-Settings", "AAMAAABkAARAAAAAAAIAAAAA")
+	res1, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("HTTP/1.1 request should not fail: %s", err)
+	}
+	res1.Body.Close()
+
+	if res1.StatusCode != http.StatusOK || res1.ProtoMajor != 1 {
+		t.Fatalf("unexpected response: %s %d", res1.Proto, res1.StatusCode)
+	}
+}
+
+func TestConfigureServer_H2CUpgrade(t *testing.T) {
+	contents := []string{"/static/app.js", "/static/app.css"}
+	ts := newH2CServer(t, casper.New(1<<6, 10), contents, &casper.ServerOptions{H2C: true})
+	defer ts.Close()
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial should not fail: %s", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	// SETTINGS_ENABLE_PUSH is 1 by default.
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: %s\r\nConnection: Upgrade, HTTP2-Settings\r\nUpgrade: h2c\r\nHTTP2-Settings: \r\n\r\n", ts.Listener.Addr())
+
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("ReadResponse should not fail: %s", err)
+	}
+
+	if res.StatusCode != http.StatusSwitchingProtocols || res.Header.Get("Upgrade") != "h2c" {
+		t.Fatalf("unexpected response: %d %v", res.StatusCode, res.Header)
+	}
+
+	if _, err := io.WriteString(conn, http2.ClientPreface); err != nil {
+		t.Fatalf("Write should not fail: %s", err)
+	}
+
+	dec := hpack.NewDecoder(4096, nil)
+	framer := http2.NewFramer(conn, br)
+	framer.ReadMetaHeaders = dec
+	if err := framer.WriteSettings(); err != nil {
+		t.Fatalf("WriteSettings should not fail: %s", err)
+	}
+
+	// The response of the upgrade request is sent on stream 1
+	// with the pushes.
+	var pushed []string
+	var status string
+	for status == "" {
+		f, err := framer.ReadFrame()
+		if err != nil {
+			t.Fatalf("ReadFrame should not fail: %s", err)
+		}
+
+		switch f := f.(type) {
+		case *http2.PushPromiseFrame:
+			if f.StreamID != 1 {
+				t.Fatalf("PUSH_PROMISE on stream %d, want 1", f.StreamID)
+			}
+
+			fields, err := dec.DecodeFull(f.HeaderBlockFragment())
+			if err != nil {
+				t.Fatalf("DecodeFull should not fail: %s", err)
+			}
+
+			for _, hf := range fields {
+				if hf.Name == ":path" {
+					pushed = append(pushed, hf.Value)
+				}
+			}
+		case *http2.MetaHeadersFrame:
+			if f.StreamID == 1 {
+				status = f.PseudoValue("status")
+			}
+		}
+	}
+
+	if status != "200" {
+		t.Fatalf("status %s, want 200", status)
+	}
+
+	if !reflect.DeepEqual(pushed, contents) {
+		t.Fatalf("pushed %v, want %v", pushed, contents)
+	}
+}
+
+func TestConfigureServer_ClientMaxConcurrentStreams(t *testing.T) {
+	c := casper.New(1<<6, 10)
+	contents := []string{"/static/a.js", "/static/b.js", "/static/c.js"}
+
+	// Pushed streams are kept open until the pushes end.
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		r, err := c.Push(w, r, contents, nil)
+		close(release)
+		if err != nil {
+			t.Errorf("Push failed: %s", err)
+			return
+		}
+
+		for i, result := range c.Results(r) {
+			if want := casper.PushStatusBudget; i > 0 && result.Status != want {
+				t.Errorf("%s is %s, want %s", result.Target, result.Status, want)
+			}
+		}
+	})
+	mux.HandleFunc("/static/", func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte("content of " + r.URL.Path))
+	})
+
+	ts := httptest.NewUnstartedServer(mux)
+	if err := casper.ConfigureServer(ts.Config, &casper.ServerOptions{H2C: true}); err != nil {
+		t.Fatalf("ConfigureServer should not fail: %s", err)
+	}
+	ts.Start()
+	defer ts.Close()
+
+	client, err := caspertest.NewClient(ts, &caspertest.ClientOptions{H2C: true, MaxConcurrentStreams: 1})
+	if err != nil {
+		t.Fatalf("NewClient should not fail: %s", err)
+	}
+	defer client.Close()
+
+	res, err := client.Get("/")
+	if err != nil {
+		t.Fatalf("Get should not fail: %s", err)
+	}
+
+	if got, want := res.Pushed(), contents[:1]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("pushed %v, want %v", got, want)
+	}
+
+	// The rest are not recorded.
+	cookie, _ := c.GenerateCookie(contents[:1])
+	if got := res.Header.Get("Set-Cookie"); got != cookie.String() {
+		t.Fatalf("Set-Cookie %q, want %q", got, cookie.String())
+	}
+}
+
+func TestConfigureServer_MaxConcurrentStreams(t *testing.T) {
+	c := casper.New(1<<6, 10)
+	contents := []string{"/static/a.js", "/static/b.js", "/static/c.js"}
+	ts := newH2CServer(t, c, contents, &casper.ServerOptions{
+		H2C:                  true,
+		MaxConcurrentStreams: 2,
+	})
+	defer ts.Close()
+
+	client, err := caspertest.NewClient(ts, &caspertest.ClientOptions{H2C: true})
+	if err != nil {
+		t.Fatalf("NewClient should not fail: %s", err)
+	}
+	defer client.Close()
+
+	res, err := client.Get("/")
+	if err != nil {
+		t.Fatalf("Get should not fail: %s", err)
+	}
+
+	if got, want := res.Pushed(), contents[:2]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("pushed %v, want %v", got, want)
+	}
+
+	cookie, _ := c.GenerateCookie(contents[:2])
+	if got := res.Header.Get("Set-Cookie"); got != cookie.String() {
+		t.Fatalf("Set-Cookie %q, want %q", got, cookie.String())
+	}
+}
+
+func TestConfigureServer_DisablePush(t *testing.T) {
+	c := casper.New(1<<6, 10)
+	ts := newH2CServer(t, c, []string{"/static/app.js"}, &casper.ServerOptions{
+		H2C:         true,
+		DisablePush: true,
+	})
+	defer ts.Close()
+
+	client, err := caspertest.NewClient(ts, &caspertest.ClientOptions{H2C: true})
+	if err != nil {
+		t.Fatalf("NewClient should not fail: %s", err)
+	}
+	defer client.Close()
+
+	res, err := client.Get("/")
+	if err != nil {
+		t.Fatalf("Get should not fail: %s", err)
+	}
+
+	if len(res.Pushes) != 0 {
+		t.Fatalf("nothing should be pushed: %v", res.Pushed())
+	}
+
+	if got := res.Header.Get("Set-Cookie"); got != "" {
+		t.Fatalf("fingerprint should not be set: %s", got)
+	}
+}
+
+func TestConfigureServer_ConnPushes(t *testing.T) {
+	// The cookie is not sent for "/", so only the connection
+	// prevents pushing the same targets again.
+	c, err := casper.NewWithConfig(&casper.Config{P: 1 << 6, N: 10, CookiePath: "/other/"})
+	if err != nil {
+		t.Fatalf("NewWithConfig should not fail: %s", err)
+	}
+	contents := []string{"/static/app.js", "/static/app.css"}
+
+	for _, h2c := range []bool{false, true} {
+		ts := httptest.NewUnstartedServer(newTestAssetHandler(t, c, contents, nil))
+		if err := casper.ConfigureServer(ts.Config, &casper.ServerOptions{H2C: h2c}); err != nil {
+			t.Fatalf("ConfigureServer should not fail: %s", err)
+		}
+
+		if h2c {
+			ts.Start()
+		} else {
+			ts.TLS = ts.Config.TLSConfig
+			ts.StartTLS()
+		}
+		defer ts.Close()
+
+		// Each connection pushes the targets once.
+		for i := 0; i < 2; i++ {
+			client, err := caspertest.NewClient(ts, &caspertest.ClientOptions{H2C: h2c})
+			if err != nil {
+				t.Fatalf("NewClient should not fail: %s", err)
+			}
+			defer client.Close()
+
+			res, err := client.Get("/")
+			if err != nil {
+				t.Fatalf("Get should not fail: %s", err)
+			}
+
+			if got := res.Pushed(); !reflect.DeepEqual(got, contents) {
+				t.Fatalf("h2c=%t: pushed %v, want %v", h2c, got, contents)
+			}
+
+			// Same connection.
+			res, err = client.Get("/")
+			if err != nil {
+				t.Fatalf("Get should not fail: %s", err)
+			}
+
+			if got := res.Pushed(); len(got) != 0 {
+				t.Fatalf("h2c=%t: nothing should be pushed on the same connection: %v", h2c, got)
+			}
+		}
+	}
+}
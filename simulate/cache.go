@@ -0,0 +1,70 @@
+package simulate
+
+import "container/list"
+
+// lruCache is the browser cache which evicts the least
+// recently used assets when it's full.
+type lruCache struct {
+	capacity int64
+	size     int64
+
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type cacheEntry struct {
+	asset string
+	size  int64
+}
+
+// newLRUCache returns a new cache. If capacity is zero,
+// it's unlimited.
+func newLRUCache(capacity int64) *lruCache {
+	return &lruCache{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (c *lruCache) contains(asset string) bool {
+	_, ok := c.items[asset]
+	return ok
+}
+
+// add adds the asset or marks it as recently used.
+func (c *lruCache) add(asset string, size int64) {
+	if e, ok := c.items[asset]; ok {
+		c.ll.MoveToFront(e)
+		return
+	}
+
+	if c.capacity > 0 && size > c.capacity {
+		// Too large to be cached.
+		return
+	}
+
+	c.items[asset] = c.ll.PushFront(&cacheEntry{asset: asset, size: size})
+	c.size += size
+
+	for c.capacity > 0 && c.size > c.capacity {
+		c.remove(c.ll.Back())
+	}
+}
+
+// evict removes the assets for which fn returns true.
+func (c *lruCache) evict(fn func(asset string) bool) {
+	for e := c.ll.Front(); e != nil; {
+		next := e.Next()
+		if fn(e.Value.(*cacheEntry).asset) {
+			c.remove(e)
+		}
+		e = next
+	}
+}
+
+func (c *lruCache) remove(e *list.Element) {
+	entry := c.ll.Remove(e).(*cacheEntry)
+	delete(c.items, entry.asset)
+	c.size -= entry.size
+}
@@ -0,0 +1,325 @@
+/*
+Package simulate replays browsing sessions against a casper to measure
+how effective the cache-aware server push is.
+
+Each session is replayed by a simulated browser which holds the
+fingerprint cookie and its own cache. The browser cache may lose assets
+(by its capacity or by eviction) while the fingerprint still claims
+them, which is when casper misses pushes. Sessions can be generated
+(see Synthetic) or read from logs (see ReadSessions).
+*/
+package simulate
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+
+	casper "github.com/tcnksm/go-casper"
+)
+
+// PageView is a page view in a session.
+type PageView struct {
+	// Page is the URL path of the page.
+	Page string `json:"page"`
+
+	// Assets are the assets which are needed by the page.
+	Assets []string `json:"assets"`
+}
+
+// Session is a sequence of page views by a single browser.
+type Session struct {
+	ID    string
+	Views []PageView
+}
+
+// ReadSessions reads sessions from JSON lines. Each line is a page
+// view with the session ID:
+//
+//	{"session": "a", "page": "/", "assets": ["/static/app.js"]}
+//
+// Page views of the same session are kept in the order of the lines.
+// Sessions are sorted by their first appearance.
+func ReadSessions(r io.Reader) ([]Session, error) {
+	var (
+		sessions []Session
+		index    = make(map[string]int)
+	)
+
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for line := 1; s.Scan(); line++ {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+
+		var v struct {
+			Session string `json:"session"`
+			PageView
+		}
+		if err := json.Unmarshal(s.Bytes(), &v); err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+
+		i, ok := index[v.Session]
+		if !ok {
+			i = len(sessions)
+			index[v.Session] = i
+			sessions = append(sessions, Session{ID: v.Session})
+		}
+		sessions[i].Views = append(sessions[i].Views, v.PageView)
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// Config is a configuration of the simulation.
+type Config struct {
+	// Casper is the casper to be simulated. It must not be used
+	// by others during the simulation.
+	Casper *casper.Casper
+
+	// PushTargets returns the targets to be pushed for the page
+	// view. If nil, the assets of the page view are pushed.
+	PushTargets func(view PageView) []string
+
+	// Sizes are the sizes of the assets in bytes. Unknown
+	// assets are 0 bytes.
+	Sizes map[string]int64
+
+	// CacheSize is the capacity of the browser cache in bytes.
+	// The least recently used assets are evicted when it's full.
+	// If zero, the capacity is unlimited.
+	CacheSize int64
+
+	// EvictProbability is the probability that each cached asset
+	// is evicted before a page view (e.g., by the user or by the
+	// other sites). The fingerprint cookie is kept.
+	EvictProbability float64
+
+	// SingleConnection serves each session on a single connection,
+	// so pushes are also deduplicated on the connection (see
+	// casper.ConnContext). Otherwise, each page view is served on
+	// a new connection.
+	SingleConnection bool
+
+	// Seed is the random seed for the eviction.
+	Seed int64
+}
+
+// Result is the result of the simulation.
+type Result struct {
+	// Sessions and PageViews are the numbers of replayed
+	// sessions and page views.
+	Sessions  int
+	PageViews int
+
+	// Pushes is the number of pushed targets.
+	Pushes int
+
+	// WastedPushes is the number of pushed targets which
+	// the browser already had in its cache.
+	WastedPushes int
+
+	// MissedPushes is the number of targets which were not
+	// pushed while the browser did not have them. It's caused
+	// by the false positives of the fingerprint or by the
+	// assets evicted from the browser cache. The targets
+	// skipped by the budget or by the connection are not
+	// included.
+	MissedPushes int
+
+	// BudgetSkips is the number of targets which were not pushed
+	// by the push budget (see casper.PushStatusBudget) while the
+	// browser did not have them.
+	BudgetSkips int
+
+	// ConnectionSkips is the number of targets which were not
+	// pushed since they were already pushed on the connection
+	// (see casper.PushStatusConnection) while the browser did
+	// not have them.
+	ConnectionSkips int
+
+	// BytesPushed is the total size of the pushed targets.
+	BytesPushed int64
+
+	// WastedBytes is the total size of the wasted pushes.
+	WastedBytes int64
+}
+
+// Run replays the sessions and returns the result.
+func Run(config *Config, sessions []Session) (*Result, error) {
+	if config.Casper == nil {
+		return nil, fmt.Errorf("casper is not configured")
+	}
+
+	pushTargets := config.PushTargets
+	if pushTargets == nil {
+		pushTargets = func(view PageView) []string { return view.Assets }
+	}
+
+	rnd := rand.New(rand.NewSource(config.Seed))
+	result := &Result{}
+	for _, session := range sessions {
+		result.Sessions++
+
+		b := newBrowser(config.CacheSize)
+		if config.SingleConnection {
+			b.connect()
+		}
+
+		for _, view := range session.Views {
+			result.PageViews++
+
+			if config.EvictProbability > 0 {
+				b.cache.evict(func(string) bool {
+					return rnd.Float64() < config.EvictProbability
+				})
+			}
+
+			results, err := b.visit(config.Casper, view.Page, pushTargets(view))
+			if err != nil {
+				b.close()
+				return nil, fmt.Errorf("session %q: %s", session.ID, err)
+			}
+
+			// The targets which were not pushed while
+			// the browser did not have them.
+			for _, r := range results {
+				if r.Status == casper.PushStatusPushed || b.cache.contains(r.Target) {
+					continue
+				}
+
+				switch r.Status {
+				case casper.PushStatusBudget:
+					result.BudgetSkips++
+				case casper.PushStatusConnection:
+					result.ConnectionSkips++
+				default:
+					result.MissedPushes++
+				}
+			}
+
+			for _, r := range results {
+				if r.Status != casper.PushStatusPushed {
+					continue
+				}
+
+				size := config.Sizes[r.Target]
+				result.Pushes++
+				result.BytesPushed += size
+				if b.cache.contains(r.Target) {
+					result.WastedPushes++
+					result.WastedBytes += size
+				}
+				b.cache.add(r.Target, size)
+			}
+
+			// The browser fetches the rest of the assets.
+			for _, asset := range view.Assets {
+				b.cache.add(asset, config.Sizes[asset])
+			}
+		}
+		b.close()
+	}
+
+	return result, nil
+}
+
+// browser is a simulated browser which holds cookies and cache.
+type browser struct {
+	cookies map[string]*http.Cookie
+	cache   *lruCache
+
+	// conn and ctx are the connection of the session
+	// if it's kept open.
+	conn net.Conn
+	ctx  context.Context
+}
+
+func newBrowser(cacheSize int64) *browser {
+	return &browser{
+		cookies: make(map[string]*http.Cookie),
+		cache:   newLRUCache(cacheSize),
+	}
+}
+
+// connect opens the connection used by the following visits.
+func (b *browser) connect() {
+	conn, peer := net.Pipe()
+	peer.Close()
+	b.conn = conn
+	b.ctx = casper.ConnContext(context.Background(), conn)
+}
+
+// close closes the connection if it's open.
+func (b *browser) close() {
+	if b.conn == nil {
+		return
+	}
+
+	casper.ConnState(b.conn, http.StateClosed)
+	b.conn.Close()
+	b.conn, b.ctx = nil, nil
+}
+
+// visit requests the page and returns the results of the targets.
+func (b *browser) visit(c *casper.Casper, page string, targets []string) ([]casper.PushResult, error) {
+	req, err := http.NewRequest("GET", page, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if b.ctx != nil {
+		req = req.WithContext(b.ctx)
+	}
+
+	for _, cookie := range b.cookies {
+		req.AddCookie(cookie)
+	}
+
+	w := &pushRecorder{header: make(http.Header)}
+	req, err = c.Push(w, req, targets, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res := http.Response{Header: w.header}
+	for _, cookie := range res.Cookies() {
+		b.cookies[cookie.Name] = cookie
+	}
+
+	// The evicted entries follow the targets.
+	results := c.Results(req)
+	if len(results) > len(targets) {
+		results = results[:len(targets)]
+	}
+	return results, nil
+}
+
+// pushRecorder is http.ResponseWriter which accepts pushes.
+type pushRecorder struct {
+	header http.Header
+}
+
+func (p *pushRecorder) Header() http.Header {
+	return p.header
+}
+
+func (p *pushRecorder) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (p *pushRecorder) WriteHeader(int) {}
+
+func (p *pushRecorder) Push(target string, opts *http.PushOptions) error {
+	return nil
+}
@@ -0,0 +1,248 @@
+package simulate
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	casper "github.com/tcnksm/go-casper"
+)
+
+func TestRun(t *testing.T) {
+	sessions := []Session{
+		{
+			ID: "a",
+			Views: []PageView{
+				{Page: "/", Assets: []string{"/app.js", "/app.css"}},
+				{Page: "/about", Assets: []string{"/app.js", "/app.css", "/about.jpg"}},
+				{Page: "/", Assets: []string{"/app.js", "/app.css"}},
+			},
+		},
+		{
+			ID: "b",
+			Views: []PageView{
+				{Page: "/about", Assets: []string{"/app.js", "/app.css", "/about.jpg"}},
+			},
+		},
+	}
+
+	result, err := Run(&Config{
+		Casper: casper.New(1<<10, 10),
+		Sizes: map[string]int64{
+			"/app.js":    100,
+			"/app.css":   10,
+			"/about.jpg": 1000,
+		},
+	}, sessions)
+	if err != nil {
+		t.Fatalf("Run should not fail: %s", err)
+	}
+
+	want := &Result{
+		Sessions:    2,
+		PageViews:   4,
+		Pushes:      6,
+		BytesPushed: 2220,
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Fatalf("Run=%+v, want=%+v", result, want)
+	}
+}
+
+func TestRun_CacheSize(t *testing.T) {
+	// The browser cache can hold only one asset, so the
+	// pushed asset is evicted by the next one.
+	sessions := []Session{
+		{
+			ID: "a",
+			Views: []PageView{
+				{Page: "/", Assets: []string{"/a.js"}},
+				{Page: "/", Assets: []string{"/b.js"}},
+				{Page: "/", Assets: []string{"/a.js"}},
+			},
+		},
+	}
+
+	result, err := Run(&Config{
+		Casper:    casper.New(1<<10, 10),
+		Sizes:     map[string]int64{"/a.js": 10, "/b.js": 10},
+		CacheSize: 10,
+	}, sessions)
+	if err != nil {
+		t.Fatalf("Run should not fail: %s", err)
+	}
+
+	if got, want := result.Pushes, 2; got != want {
+		t.Fatalf("Pushes=%d, want=%d", got, want)
+	}
+
+	if got, want := result.MissedPushes, 1; got != want {
+		t.Fatalf("MissedPushes=%d, want=%d", got, want)
+	}
+}
+
+func TestRun_BudgetSkips(t *testing.T) {
+	sessions := []Session{
+		{
+			ID: "a",
+			Views: []PageView{
+				{Page: "/", Assets: []string{"/a.js", "/b.js"}},
+			},
+		},
+	}
+
+	c, err := casper.NewWithConfig(&casper.Config{P: 1 << 10, N: 10, MaxPushes: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Run(&Config{Casper: c}, sessions)
+	if err != nil {
+		t.Fatalf("Run should not fail: %s", err)
+	}
+
+	if result.Pushes != 1 || result.BudgetSkips != 1 || result.MissedPushes != 0 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+}
+
+func TestRun_SingleConnection(t *testing.T) {
+	// The fingerprint holds only one entry, so /a.js is evicted
+	// from it but it's still known to be pushed on the connection.
+	sessions := []Session{
+		{
+			ID: "a",
+			Views: []PageView{
+				{Page: "/", Assets: []string{"/a.js"}},
+				{Page: "/", Assets: []string{"/b.js"}},
+				{Page: "/", Assets: []string{"/a.js"}},
+			},
+		},
+	}
+
+	cases := []struct {
+		singleConnection bool
+		want             Result
+	}{
+		{false, Result{Sessions: 1, PageViews: 3, Pushes: 3, BytesPushed: 30}},
+		{true, Result{Sessions: 1, PageViews: 3, Pushes: 2, BytesPushed: 20, ConnectionSkips: 1}},
+	}
+
+	for _, tc := range cases {
+		result, err := Run(&Config{
+			Casper:           casper.New(1<<10, 1),
+			Sizes:            map[string]int64{"/a.js": 10, "/b.js": 10},
+			CacheSize:        10,
+			SingleConnection: tc.singleConnection,
+		}, sessions)
+		if err != nil {
+			t.Fatalf("Run should not fail: %s", err)
+		}
+
+		if !reflect.DeepEqual(*result, tc.want) {
+			t.Fatalf("SingleConnection=%t: Run=%+v, want=%+v", tc.singleConnection, result, tc.want)
+		}
+	}
+}
+
+func TestRun_WastedPushes(t *testing.T) {
+	// The browser already has the assets (fetched without push)
+	// but casper does not know it.
+	sessions := []Session{
+		{
+			ID: "a",
+			Views: []PageView{
+				{Page: "/", Assets: []string{"/a.js"}},
+				{Page: "/b", Assets: []string{"/a.js"}},
+			},
+		},
+	}
+
+	result, err := Run(&Config{
+		Casper: casper.New(1<<10, 10),
+		Sizes:  map[string]int64{"/a.js": 10},
+		PushTargets: func(view PageView) []string {
+			if view.Page == "/" {
+				return nil
+			}
+			return view.Assets
+		},
+	}, sessions)
+	if err != nil {
+		t.Fatalf("Run should not fail: %s", err)
+	}
+
+	if result.WastedPushes != 1 || result.WastedBytes != 10 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+}
+
+func TestReadSessions(t *testing.T) {
+	input := `{"session": "a", "page": "/", "assets": ["/app.js"]}
+{"session": "b", "page": "/about", "assets": ["/app.js", "/about.jpg"]}
+
+{"session": "a", "page": "/about", "assets": ["/app.js", "/about.jpg"]}
+`
+
+	sessions, err := ReadSessions(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ReadSessions should not fail: %s", err)
+	}
+
+	want := []Session{
+		{
+			ID: "a",
+			Views: []PageView{
+				{Page: "/", Assets: []string{"/app.js"}},
+				{Page: "/about", Assets: []string{"/app.js", "/about.jpg"}},
+			},
+		},
+		{
+			ID: "b",
+			Views: []PageView{
+				{Page: "/about", Assets: []string{"/app.js", "/about.jpg"}},
+			},
+		},
+	}
+	if !reflect.DeepEqual(sessions, want) {
+		t.Fatalf("ReadSessions=%+v, want=%+v", sessions, want)
+	}
+
+	if _, err := ReadSessions(strings.NewReader("{")); err == nil {
+		t.Fatalf("ReadSessions should fail for invalid input")
+	}
+}
+
+func TestSynthetic(t *testing.T) {
+	s := &Synthetic{
+		Pages: []PageView{
+			{Page: "/", Assets: []string{"/app.js"}},
+			{Page: "/about", Assets: []string{"/app.js", "/about.jpg"}},
+		},
+		Sessions: 10,
+		MinViews: 1,
+		MaxViews: 5,
+		Seed:     1,
+	}
+
+	sessions, err := s.Generate()
+	if err != nil {
+		t.Fatalf("Generate should not fail: %s", err)
+	}
+
+	if got, want := len(sessions), 10; got != want {
+		t.Fatalf("number of sessions %d, want %d", got, want)
+	}
+
+	for _, session := range sessions {
+		if n := len(session.Views); n < 1 || n > 5 {
+			t.Fatalf("number of views %d is out of range", n)
+		}
+	}
+
+	// Same seed generates same sessions.
+	again, _ := s.Generate()
+	if !reflect.DeepEqual(sessions, again) {
+		t.Fatalf("Generate should be deterministic")
+	}
+}
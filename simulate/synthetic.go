@@ -0,0 +1,67 @@
+package simulate
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// Synthetic generates sessions of random page views. Pages are chosen
+// by Zipf distribution, so that a few pages are viewed most often.
+type Synthetic struct {
+	// Pages are the pages which can be viewed. Assets of each
+	// page view are the assets of the page.
+	Pages []PageView
+
+	// Sessions is the number of sessions.
+	Sessions int
+
+	// MinViews and MaxViews are the range of the number of
+	// page views in a session.
+	MinViews int
+	MaxViews int
+
+	// Skew is the skew of the page popularity. It must be
+	// larger than 1. If zero, 1.1 is used.
+	Skew float64
+
+	// Seed is the random seed.
+	Seed int64
+}
+
+// Generate generates the sessions.
+func (s *Synthetic) Generate() ([]Session, error) {
+	if len(s.Pages) == 0 {
+		return nil, fmt.Errorf("no pages")
+	}
+
+	if s.MinViews <= 0 || s.MaxViews < s.MinViews {
+		return nil, fmt.Errorf("invalid number of views: %d-%d", s.MinViews, s.MaxViews)
+	}
+
+	skew := s.Skew
+	if skew == 0 {
+		skew = 1.1
+	}
+
+	if skew <= 1 {
+		return nil, fmt.Errorf("skew must be larger than 1")
+	}
+
+	rnd := rand.New(rand.NewSource(s.Seed))
+	zipf := rand.NewZipf(rnd, skew, 1, uint64(len(s.Pages)-1))
+
+	sessions := make([]Session, s.Sessions)
+	for i := range sessions {
+		n := s.MinViews + rnd.Intn(s.MaxViews-s.MinViews+1)
+		views := make([]PageView, n)
+		for j := range views {
+			views[j] = s.Pages[zipf.Uint64()]
+		}
+
+		sessions[i] = Session{
+			ID:    fmt.Sprintf("session-%d", i),
+			Views: views,
+		}
+	}
+	return sessions, nil
+}
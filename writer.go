@@ -0,0 +1,97 @@
+package casper
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// rwUnwrapper is implemented by http.ResponseWriter wrappers which
+// expose the original writer. It's the same convention as used by
+// http.ResponseController.
+type rwUnwrapper interface {
+	Unwrap() http.ResponseWriter
+}
+
+// pusherFinder is implemented by ResponseWriter (and the writers
+// which embed it). Its Push always exists, so findPusher asks it for
+// the pusher of the wrapped writer instead.
+type pusherFinder interface {
+	pusher() (http.Pusher, bool)
+}
+
+// findPusher returns the http.Pusher of the given writer. If the writer
+// does not implement it, it follows the Unwrap chain of the wrappers
+// (e.g., by logging or compression middleware) like http.ResponseController.
+func findPusher(w http.ResponseWriter) (http.Pusher, bool) {
+	for {
+		if f, ok := w.(pusherFinder); ok {
+			return f.pusher()
+		}
+
+		if p, ok := w.(http.Pusher); ok {
+			return p, true
+		}
+
+		u, ok := w.(rwUnwrapper)
+		if !ok {
+			return nil, false
+		}
+		w = u.Unwrap()
+	}
+}
+
+// ResponseWriter is a http.ResponseWriter wrapper which keeps the optional
+// interfaces (http.Pusher, http.Flusher and http.Hijacker) of the wrapped
+// writer. Middleware can embed it and override only what it needs, so
+// that casper can still push through it:
+//
+//	type statusWriter struct {
+//		*casper.ResponseWriter
+//		status int
+//	}
+//
+//	func (w *statusWriter) WriteHeader(code int) {
+//		w.status = code
+//		w.ResponseWriter.WriteHeader(code)
+//	}
+type ResponseWriter struct {
+	http.ResponseWriter
+}
+
+// WrapResponseWriter returns a new ResponseWriter which wraps w.
+func WrapResponseWriter(w http.ResponseWriter) *ResponseWriter {
+	return &ResponseWriter{ResponseWriter: w}
+}
+
+// Unwrap returns the wrapped writer. It's used by http.ResponseController.
+func (w *ResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Push implements http.Pusher. It returns http.ErrNotSupported if
+// the wrapped writer does not support server push.
+func (w *ResponseWriter) Push(target string, opts *http.PushOptions) error {
+	p, ok := w.pusher()
+	if !ok {
+		return http.ErrNotSupported
+	}
+	return p.Push(target, opts)
+}
+
+// pusher returns the http.Pusher of the wrapped writer.
+func (w *ResponseWriter) pusher() (http.Pusher, bool) {
+	return findPusher(w.ResponseWriter)
+}
+
+// Flush implements http.Flusher. It does nothing if the wrapped
+// writer does not support flushing.
+func (w *ResponseWriter) Flush() {
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Hijack implements http.Hijacker. It returns http.ErrNotSupported
+// if the wrapped writer does not support hijacking.
+func (w *ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
@@ -0,0 +1,132 @@
+package casper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// unwrapWriter is a middleware writer which hides http.Pusher
+// but implements Unwrap.
+type unwrapWriter struct {
+	http.ResponseWriter
+}
+
+func (w *unwrapWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// opaqueWriter is a middleware writer which hides everything.
+type opaqueWriter struct {
+	http.ResponseWriter
+}
+
+// statusWriter is a middleware writer built on ResponseWriter.
+type statusWriter struct {
+	*ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func TestPush_WrappedWriter(t *testing.T) {
+	cases := []struct {
+		wrap    func(w http.ResponseWriter) http.ResponseWriter
+		success bool
+	}{
+		{
+			func(w http.ResponseWriter) http.ResponseWriter { return w },
+			true,
+		},
+		{
+			func(w http.ResponseWriter) http.ResponseWriter {
+				return &unwrapWriter{&unwrapWriter{w}}
+			},
+			true,
+		},
+		{
+			func(w http.ResponseWriter) http.ResponseWriter {
+				return &statusWriter{ResponseWriter: WrapResponseWriter(&unwrapWriter{w})}
+			},
+			true,
+		},
+		{
+			func(w http.ResponseWriter) http.ResponseWriter { return &opaqueWriter{w} },
+			false,
+		},
+		{
+			func(w http.ResponseWriter) http.ResponseWriter {
+				return WrapResponseWriter(&opaqueWriter{w})
+			},
+			false,
+		},
+	}
+
+	for i, tc := range cases {
+		c := New(1<<6, 10)
+		rec := newPushRecorder()
+
+		_, err := c.Push(tc.wrap(rec), httptest.NewRequest("GET", "/", nil), []string{"/static/app.js"}, nil)
+		if got := err == nil; got != tc.success {
+			t.Fatalf("#%d expect %t, got %t: %v", i, tc.success, got, err)
+		}
+
+		if !tc.success {
+			continue
+		}
+
+		if got, want := rec.pushed, []string{"/static/app.js"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("#%d pushed %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestPush_HTTP1WrappedWriter(t *testing.T) {
+	c := New(1<<6, 10)
+	rec := httptest.NewRecorder()
+	w := &statusWriter{ResponseWriter: WrapResponseWriter(rec)}
+
+	_, err := c.Push(w, httptest.NewRequest("GET", "/", nil), []string{"/static/app.js"}, nil)
+	if err != errPushNotSupported {
+		t.Fatalf("Push should return errPushNotSupported: %v", err)
+	}
+
+	if cookie := rec.Header().Get("Set-Cookie"); cookie != "" {
+		t.Fatalf("cookie should not be set: %q", cookie)
+	}
+}
+
+func TestResponseWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := &statusWriter{ResponseWriter: WrapResponseWriter(rec)}
+
+	var (
+		_ http.Pusher  = w
+		_ http.Flusher = w
+	)
+
+	w.WriteHeader(http.StatusTeapot)
+	w.Write([]byte("body"))
+	w.Flush()
+
+	if w.status != http.StatusTeapot || rec.Code != http.StatusTeapot {
+		t.Fatalf("status %d (recorded %d), want %d", w.status, rec.Code, http.StatusTeapot)
+	}
+
+	if !rec.Flushed {
+		t.Fatalf("writer should be flushed")
+	}
+
+	// httptest.ResponseRecorder supports neither push nor hijack.
+	if err := w.Push("/static/app.js", nil); err != http.ErrNotSupported {
+		t.Fatalf("Push should return ErrNotSupported: %v", err)
+	}
+
+	if _, _, err := w.Hijack(); err == nil {
+		t.Fatalf("Hijack should fail")
+	}
+}